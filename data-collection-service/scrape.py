@@ -106,6 +106,12 @@ class RateLimiter:
         return True
 
 class MangaScraper:
+    # AniList relation types, lowercased as stored in manga_relations
+    RELATION_TYPES = {
+        'adaptation', 'prequel', 'sequel', 'parent', 'side_story', 'character', 'summary',
+        'alternative', 'spin_off', 'other', 'source', 'compilation', 'contains'
+    }
+    
     def __init__(self, config_file='config.json'):
         # Load configuration
         with open(config_file, 'r') as f:
@@ -138,6 +144,7 @@ class MangaScraper:
         self.update_interval_hours = self.scrape_config.get('update_interval_hours', 24)
         self.batch_size = self.scrape_config.get('batch_size', 50)
         self.publisher_match_threshold = self.scrape_config.get('publisher_match_threshold', 0.8)
+        self.relations_refresh_days = self.scrape_config.get('relations_refresh_days', 7)
         
         # Load valid publishers
         self.valid_publishers = self.load_valid_publishers()
@@ -326,9 +333,12 @@ class MangaScraper:
                         edges {
                             relationType
                             node {
+                                id
                                 type
+                                format
                                 title {
                                     romaji
+                                    english
                                 }
                             }
                         }
@@ -339,7 +349,41 @@ class MangaScraper:
         '''
         
         variables = {'page': page, 'perPage': per_page}
+        return self.post_anilist_query(query, variables)
+    
+    def fetch_anilist_relations(self, anilist_ids: List[int]) -> List[Dict]:
+        """Fetch just the relations of the given AniList manga"""
+        self.rate_limiter.check_and_wait('anilist')
         
+        query = '''
+        query ($ids: [Int], $perPage: Int) {
+            Page(page: 1, perPage: $perPage) {
+                media(id_in: $ids, type: MANGA) {
+                    id
+                    relations {
+                        edges {
+                            relationType
+                            node {
+                                id
+                                type
+                                format
+                                title {
+                                    romaji
+                                    english
+                                }
+                            }
+                        }
+                    }
+                }
+            }
+        }
+        '''
+        
+        data = self.post_anilist_query(query, {'ids': anilist_ids, 'perPage': len(anilist_ids)})
+        return data['data']['Page']['media']
+    
+    def post_anilist_query(self, query: str, variables: Dict) -> Dict:
+        """POST a GraphQL query to AniList, waiting out rate limits"""
         headers = {
             'Content-Type': 'application/json',
             'Accept': 'application/json'
@@ -365,7 +409,7 @@ class MangaScraper:
                 retry_after = int(response.headers.get('Retry-After', 60))
                 print(f"  Rate limited by AniList, waiting {retry_after}s...")
                 sleep(retry_after)
-                return self.fetch_anilist_manga(page, per_page)
+                return self.post_anilist_query(query, variables)
             elif response.status_code == 400:
                 # Bad request - log response for debugging
                 print(f"  ✗ AniList 400 Error Response: {response.text}")
@@ -747,9 +791,103 @@ class MangaScraper:
             'cover_image_url': cover_url,
             'cover_image_s3_key': cover_s3_key,
             'anilist_url': manga.get('siteUrl'),
-            'adaptations': adaptations
+            'adaptations': adaptations,
+            'relations': self.process_relations(manga)
         }
     
+    def process_relations(self, manga: Dict) -> List[Dict]:
+        """Flatten AniList relation edges into manga_relations rows"""
+        relations = []
+        for edge in (manga.get('relations') or {}).get('edges', []):
+            node = edge.get('node') or {}
+            relation_type = (edge.get('relationType') or '').lower()
+            if not node.get('id') or relation_type not in self.RELATION_TYPES:
+                continue
+            title = node.get('title') or {}
+            relations.append({
+                'anilist_id': node['id'],
+                'relation_type': relation_type,
+                'type': node.get('type'),
+                'format': node.get('format'),
+                'title': title.get('english') or title.get('romaji')
+            })
+        return relations
+    
+    def save_relations(self, manga_id: int, relations: List[Dict]):
+        """Replace a manga's relations with what AniList reported"""
+        try:
+            with self.conn.cursor() as cur:
+                cur.execute("DELETE FROM manga_relations WHERE manga_id = %s", (manga_id,))
+                for relation in relations:
+                    cur.execute("""
+                        INSERT INTO manga_relations (
+                            manga_id, related_anilist_id, relation_type,
+                            related_type, related_format, related_title
+                        ) VALUES (%s, %s, %s, %s, %s, %s)
+                        ON CONFLICT DO NOTHING
+                    """, (
+                        manga_id, relation['anilist_id'], relation['relation_type'],
+                        relation['type'], relation['format'], relation['title']
+                    ))
+                cur.execute(
+                    "UPDATE manga SET relations_checked_at = CURRENT_TIMESTAMP WHERE id = %s",
+                    (manga_id,)
+                )
+                self.conn.commit()
+        except Exception as e:
+            print(f"  ✗ Error saving relations: {e}")
+            self.conn.rollback()
+    
+    def refresh_relations(self) -> int:
+        """Refresh relations for a batch of manga, oldest check first"""
+        stale_before = datetime.now() - timedelta(days=self.relations_refresh_days)
+        try:
+            with self.conn.cursor() as cur:
+                cur.execute("""
+                    SELECT id, anilist_id FROM manga
+                    WHERE anilist_id IS NOT NULL
+                    AND (relations_checked_at IS NULL OR relations_checked_at < %s)
+                    ORDER BY relations_checked_at NULLS FIRST, popularity DESC NULLS LAST
+                    LIMIT %s
+                """, (stale_before, min(self.batch_size, 50)))  # AniList pages hold at most 50
+                ids = dict((anilist_id, manga_id) for manga_id, anilist_id in cur.fetchall())
+        except Exception as e:
+            print(f"Error fetching manga for relation refresh: {e}")
+            self.conn.rollback()
+            return 0
+        
+        if not ids:
+            return 0
+        
+        try:
+            media = self.fetch_anilist_relations(list(ids.keys()))
+        except Exception as e:
+            print(f"  ✗ Error fetching relations: {e}")
+            return 0
+        
+        returned = set()
+        for manga in media:
+            manga_id = ids.get(manga.get('id'))
+            if manga_id:
+                self.save_relations(manga_id, self.process_relations(manga))
+                returned.add(manga_id)
+        
+        # AniList leaves out IDs it no longer knows; stamp those as well so
+        # they don't stay at the front of the queue every cycle.
+        missing = [manga_id for manga_id in ids.values() if manga_id not in returned]
+        if missing:
+            try:
+                with self.conn.cursor() as cur:
+                    cur.execute(
+                        "UPDATE manga SET relations_checked_at = CURRENT_TIMESTAMP WHERE id = ANY(%s)",
+                        (missing,)
+                    )
+                    self.conn.commit()
+            except Exception as e:
+                print(f"  ✗ Error marking relations checked: {e}")
+                self.conn.rollback()
+        return len(media)
+    
     def extract_volume_number(self, title: str) -> Optional[int]:
         """Extract volume number from title"""
         import re
@@ -916,6 +1054,8 @@ class MangaScraper:
                 manga_id = self.insert_or_update_manga(manga_data)
                 
                 if manga_id:
+                    self.save_relations(manga_id, manga_data['relations'])
+                    
                     # Only fetch volumes if manga was inserted (not just updated)
                     if self.has_english_release(manga):
                         volumes = self.check_for_new_volumes(manga_id, manga_data)
@@ -1083,6 +1223,9 @@ class MangaScraper:
         volume_count = 0
         errors = 0
         
+        relations_refreshed = self.refresh_relations()
+        print(f"Refreshed relations for {relations_refreshed} manga")
+        
         manga_list = self.get_manga_for_update()
         print(f"Found {len(manga_list)} manga to check (from top {self.initial_fetch_count})")
         
@@ -1109,6 +1252,7 @@ class MangaScraper:
         print(f"\n{'='*60}")
         print(f"Update complete:")
         print(f"  Manga checked: {manga_count}")
+        print(f"  Relations refreshed: {relations_refreshed}")
         print(f"  New volumes: {volume_count}")
         print(f"  Errors: {errors}")
         print(f"  Duration: {duration}")
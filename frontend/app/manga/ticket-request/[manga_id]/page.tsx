@@ -6,6 +6,8 @@ import { fetchManga, submitTicket } from "@/lib/actions";
 import { buildS3ImageUrl, unwrapString } from "@/lib/helpers";
 import type { Manga } from "@/lib/types";
 
+const FORMATS = ["standard", "tankobon", "omnibus", "deluxe", "hardcover", "box_set", "digital", "other"];
+
 export default function MangaTicketPage() {
   const router = useRouter();
   const params = useParams();
@@ -16,6 +18,10 @@ export default function MangaTicketPage() {
   const [volumeTitle, setVolumeTitle] = useState<string>("");
   const [volumeNumber, setVolumeNumber] = useState<string>("");
   const [submissionNotes, setSubmissionNotes] = useState<string>("");
+  const [format, setFormat] = useState<string>("");
+  const [omnibusStart, setOmnibusStart] = useState<string>("");
+  const [omnibusEnd, setOmnibusEnd] = useState<string>("");
+  const collectsVolumes = format === "omnibus" || format === "box_set";
 
   useEffect(() => {
     fetchManga(manga_id)
@@ -40,6 +46,10 @@ export default function MangaTicketPage() {
       alert("Please fill in all fields and select an image.");
       return;
     }
+    if (collectsVolumes && (!omnibusStart || !omnibusEnd || Number(omnibusStart) > Number(omnibusEnd))) {
+      alert("Please enter the range of volumes this collects.");
+      return;
+    }
 
     const formData = new FormData();
 
@@ -47,6 +57,13 @@ export default function MangaTicketPage() {
     formData.append("volume_title", volumeTitle);
     formData.append("volume_number", volumeNumber);
     formData.append("submission_notes", submissionNotes);
+    if (format) {
+      formData.append("format", format);
+    }
+    if (collectsVolumes) {
+      formData.append("omnibus_start", omnibusStart);
+      formData.append("omnibus_end", omnibusEnd);
+    }
     formData.append("image", selectedImage);
 
     submitTicket(formData)
@@ -126,6 +143,36 @@ export default function MangaTicketPage() {
                 onChange={(e) => {setVolumeNumber(e.target.value)}}
                 className="w-full max-w-xs px-4 py-2 rounded bg-[#333] border border-gray-600 text-white placeholder-gray-400 focus:outline-none focus:border-white transition-colors"
               />
+              <select
+                value={format}
+                onChange={(e) => {setFormat(e.target.value)}}
+                className="w-full max-w-xs px-4 py-2 rounded bg-[#333] border border-gray-600 text-white focus:outline-none focus:border-white transition-colors"
+              >
+                <option value="">Format (default edition)</option>
+                {FORMATS.map(f => (
+                  <option key={f} value={f}>{f.replace("_", " ")}</option>
+                ))}
+              </select>
+              {collectsVolumes && (
+                <div className="w-full max-w-xs flex gap-2">
+                  <input
+                    type="number"
+                    min={1}
+                    placeholder="First volume"
+                    value={omnibusStart}
+                    onChange={(e) => {setOmnibusStart(e.target.value)}}
+                    className="w-1/2 px-4 py-2 rounded bg-[#333] border border-gray-600 text-white placeholder-gray-400 focus:outline-none focus:border-white transition-colors"
+                  />
+                  <input
+                    type="number"
+                    min={1}
+                    placeholder="Last volume"
+                    value={omnibusEnd}
+                    onChange={(e) => {setOmnibusEnd(e.target.value)}}
+                    className="w-1/2 px-4 py-2 rounded bg-[#333] border border-gray-600 text-white placeholder-gray-400 focus:outline-none focus:border-white transition-colors"
+                  />
+                </div>
+              )}
               <button 
                 type="submit"
                 onClick={submitTicketRequest}
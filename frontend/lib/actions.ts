@@ -160,11 +160,10 @@ export async function resendVerification(email: string): Promise<Response> {
 }
 
 export async function searchManga(query: string, searchFrom: SearchFrom, by: SearchBy, includeCredentials = false): Promise<SearchResponse> {
-  const response = await apiFetch(`/mangas/search?query=${encodeURIComponent(query)}`, {
-    method: "POST",
-    headers: { "Content-Type": "application/json" },
+  const params = new URLSearchParams({ q: query, by, scope: searchFrom });
+  const response = await apiFetch(`/mangas/v1/search?${params.toString()}`, {
+    method: "GET",
     credentials: includeCredentials ? "include" : "same-origin",
-    body: JSON.stringify({ searchFrom, by }),
   });
 
   if (!response.ok) {
@@ -209,7 +208,7 @@ export async function fetchManga(mangaId: string): Promise<Manga | null> {
 }
 
 export async function fetchVolumes(mangaId: string, offset = 0): Promise<MangaVolumesResponse> {
-  const response = await apiFetch(`/mangas/${mangaId}/volumes?offset=${offset}`);
+  const response = await apiFetch(`/mangas/${mangaId}/volumes?offset=${offset}`, { credentials: "include" });
   if (!response.ok) return { volumes: [], hasMore: false };
 
   const data = await parseJsonSafe<Partial<MangaVolumesResponse>>(response);
@@ -220,7 +219,7 @@ export async function fetchVolumes(mangaId: string, offset = 0): Promise<MangaVo
 }
 
 export async function fetchVolume(mangaId: string, volumeId: string): Promise<Volume | null> {
-  const response = await apiFetch(`/mangas/${mangaId}/volumes/${volumeId}`);
+  const response = await apiFetch(`/mangas/${mangaId}/volumes/${volumeId}`, { credentials: "include" });
   if (!response.ok) return null;
   return parseJsonSafe<Volume>(response);
 }
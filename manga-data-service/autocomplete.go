@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const (
+	defaultAutocompleteLimit = 5
+	maxAutocompleteLimit     = 10
+	maxAutocompleteQueryLen  = 100
+	// Below this many characters trigrams match too much, so only prefixes
+	// are used.
+	minFuzzyQueryLen = 3
+	// Suggestions are dropped rather than shown late.
+	autocompleteTimeout = 300 * time.Millisecond
+)
+
+type Suggestion struct {
+	ID           int     `json:"id"`
+	MangaID      int     `json:"manga_id"`
+	Text         string  `json:"text"`
+	VolumeNumber *int    `json:"volume_number,omitempty"`
+	CoverS3Key   *string `json:"cover_s3_key"`
+}
+
+// Titles starting with the query come first, then fuzzy matches; popular
+// series win ties. $1 query, $2 escaped LIKE prefix, $3 fuzzy on/off,
+// $4 limit.
+const mangaSuggestionsSQL = `
+	SELECT m.id, best.title, m.cover_image_s3_key
+	FROM (
+		SELECT DISTINCT ON (id) id, title, prefix, sim
+		FROM (
+			SELECT id, title_english AS title, lower(title_english) LIKE $2 AS prefix, similarity(title_english, $1) AS sim
+			FROM manga WHERE lower(title_english) LIKE $2 OR ($3 AND title_english % $1)
+			UNION ALL
+			SELECT id, title_romaji, lower(title_romaji) LIKE $2, similarity(title_romaji, $1)
+			FROM manga WHERE lower(title_romaji) LIKE $2 OR ($3 AND title_romaji % $1)
+			UNION ALL
+			SELECT id, title_native, lower(title_native) LIKE $2, similarity(title_native, $1)
+			FROM manga WHERE lower(title_native) LIKE $2 OR ($3 AND title_native % $1)
+		) matches
+		ORDER BY id, prefix DESC, sim DESC
+	) best
+	JOIN manga m ON m.id = best.id
+	ORDER BY best.prefix DESC, m.popularity DESC NULLS LAST, best.sim DESC, m.id
+	LIMIT $4`
+
+const volumeSuggestionsSQL = `
+	SELECT v.id, v.manga_id, v.title, v.volume_number, COALESCE(v.thumbnail_s3_key, m.cover_image_s3_key)
+	FROM volumes v
+	JOIN manga m ON m.id = v.manga_id
+	WHERE lower(v.title) LIKE $2 OR ($3 AND v.title % $1)
+	ORDER BY lower(v.title) LIKE $2 DESC, m.popularity DESC NULLS LAST, similarity(v.title, $1) DESC,
+	         v.volume_number NULLS LAST, v.id
+	LIMIT $4`
+
+// likePrefix escapes LIKE wildcards in q and appends %.
+func likePrefix(q string) string {
+	return likeEscaper.Replace(strings.ToLower(q)) + "%"
+}
+
+// autocomplete returns up to limit manga and volume suggestions for a
+// search box prefix (?q=), with cover keys to render them.
+func autocomplete(c *gin.Context) {
+	godotenv.Load()
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(400, gin.H{"error": "Missing query"})
+		return
+	}
+	if utf8.RuneCountInString(q) > maxAutocompleteQueryLen {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Query can't be longer than %d characters", maxAutocompleteQueryLen)})
+		return
+	}
+	limit, ok := queryLimit(c, defaultAutocompleteLimit, maxAutocompleteLimit)
+	if !ok {
+		return
+	}
+	fuzzy := utf8.RuneCountInString(q) >= minFuzzyQueryLen
+	prefix := likePrefix(q)
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Server error"})
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), autocompleteTimeout)
+	defer cancel()
+
+	manga := []Suggestion{}
+	rows, err := conn.QueryContext(ctx, mangaSuggestionsSQL, q, prefix, fuzzy, limit)
+	if err == nil {
+		for rows.Next() {
+			var s Suggestion
+			if err = rows.Scan(&s.ID, &s.Text, &s.CoverS3Key); err != nil {
+				break
+			}
+			s.MangaID = s.ID
+			manga = append(manga, s)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+	}
+
+	volumes := []Suggestion{}
+	if err == nil {
+		rows, err = conn.QueryContext(ctx, volumeSuggestionsSQL, q, prefix, fuzzy, limit)
+	}
+	if err == nil {
+		for rows.Next() {
+			var s Suggestion
+			if err = rows.Scan(&s.ID, &s.MangaID, &s.Text, &s.VolumeNumber, &s.CoverS3Key); err != nil {
+				break
+			}
+			volumes = append(volumes, s)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		c.JSON(504, gin.H{"error": "Autocomplete timed out"})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(200, gin.H{"query": q, "manga": manga, "volumes": volumes})
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultBrowseLimit = 20
+	maxBrowseLimit     = 100
+	// Genres, statuses and countries are small sets and are listed in full;
+	// tags are capped to the most common ones.
+	maxTagFacets = 50
+)
+
+// A browse sort order. key is an expression that never yields NULL, so it
+// can take part in keyset comparisons; cast turns a cursor value back into
+// its type.
+type browseSort struct {
+	key  string
+	cast string
+	desc bool
+}
+
+var browseSorts = map[string]browseSort{
+	"popularity": {"COALESCE(m.popularity, -1)", "bigint", true},
+	"score":      {"COALESCE(m.average_score, -1)", "bigint", true},
+	"title":      {"lower(COALESCE(m.title_english, m.title_romaji, m.title_native, ''))", "text", false},
+	"start_date": {"COALESCE(m.start_date, DATE '0001-01-01')", "date", true},
+	"volumes":    {"COALESCE(m.total_volumes, -1)", "bigint", true},
+}
+
+// browseCursor is the position after the last row of a page. It is handed
+// out base64-encoded and is only valid for the same sort and order.
+type browseCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func (cur browseCursor) encode() string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeBrowseCursor also checks that Value parses as sort's cast, so a
+// tampered cursor is rejected here instead of failing in Postgres.
+func decodeBrowseCursor(s string, sort browseSort) (browseCursor, bool) {
+	var cur browseCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &cur) != nil {
+		return cur, false
+	}
+	switch sort.cast {
+	case "bigint":
+		_, err = strconv.ParseInt(cur.Value, 10, 64)
+	case "date":
+		_, err = time.Parse("2006-01-02", cur.Value)
+	}
+	return cur, err == nil
+}
+
+// sqlArgs numbers placeholders as conditions are built.
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// A browse filter. facet names the facet it narrows, so that facet's counts
+// can be computed without it and still show the other options.
+type browseFilter struct {
+	facet string
+	cond  func(args *sqlArgs) string
+}
+
+type browseFilters []browseFilter
+
+func (fs browseFilters) where(except string, args *sqlArgs) string {
+	conds := []string{"TRUE"}
+	for _, f := range fs {
+		if except != "" && f.facet == except {
+			continue
+		}
+		conds = append(conds, f.cond(args))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// queryList returns every value of a repeatable query parameter, also
+// accepting comma separated lists (?genre=Action,Drama).
+func queryList(c *gin.Context, name string) []string {
+	var values []string
+	for _, raw := range c.QueryArray(name) {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+func queryInt(c *gin.Context, name string, min int, max int) (int, bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < min || n > max {
+		return 0, false, fmt.Errorf("%s must be a number from %d to %d", name, min, max)
+	}
+	return n, true, nil
+}
+
+// parseBrowseFilters reads the catalog filters:
+//   - genre, tag: the manga has all of them; exclude_genre, exclude_tag: none
+//   - status, country: any of them (country matches country_of_origin)
+//   - start_year_from, start_year_to: start_date year, inclusive
+//   - min_score, max_score: average_score, inclusive
+//   - adult: "true" for adult titles only, "false" to hide them
+func parseBrowseFilters(c *gin.Context) (browseFilters, error) {
+	var filters browseFilters
+
+	if genres := queryList(c, "genre"); len(genres) > 0 {
+		filters = append(filters, browseFilter{"genres", func(a *sqlArgs) string {
+			return "m.genres @> " + a.add(pq.Array(genres)) + "::text[]"
+		}})
+	}
+	if genres := queryList(c, "exclude_genre"); len(genres) > 0 {
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string {
+			return "NOT COALESCE(m.genres && " + a.add(pq.Array(genres)) + "::text[], FALSE)"
+		}})
+	}
+	if tags := queryList(c, "tag"); len(tags) > 0 {
+		filters = append(filters, browseFilter{"tags", func(a *sqlArgs) string {
+			return "m.tags @> " + a.add(pq.Array(tags)) + "::text[]"
+		}})
+	}
+	if tags := queryList(c, "exclude_tag"); len(tags) > 0 {
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string {
+			return "NOT COALESCE(m.tags && " + a.add(pq.Array(tags)) + "::text[], FALSE)"
+		}})
+	}
+	if statuses := queryList(c, "status"); len(statuses) > 0 {
+		for i := range statuses {
+			statuses[i] = strings.ToUpper(statuses[i])
+		}
+		filters = append(filters, browseFilter{"status", func(a *sqlArgs) string {
+			return "m.status = ANY(" + a.add(pq.Array(statuses)) + "::text[])"
+		}})
+	}
+	if countries := queryList(c, "country"); len(countries) > 0 {
+		for i := range countries {
+			countries[i] = strings.ToUpper(countries[i])
+		}
+		filters = append(filters, browseFilter{"country_of_origin", func(a *sqlArgs) string {
+			return "m.country_of_origin = ANY(" + a.add(pq.Array(countries)) + "::text[])"
+		}})
+	}
+
+	yearFrom, ok, err := queryInt(c, "start_year_from", 1, 9999)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string {
+			return "m.start_date >= make_date(" + a.add(yearFrom) + "::int, 1, 1)"
+		}})
+	}
+	yearTo, ok, err := queryInt(c, "start_year_to", 1, 9999)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string {
+			return "m.start_date < make_date(" + a.add(yearTo+1) + "::int, 1, 1)"
+		}})
+	}
+
+	minScore, ok, err := queryInt(c, "min_score", 0, 100)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string {
+			return "m.average_score >= " + a.add(minScore)
+		}})
+	}
+	maxScore, ok, err := queryInt(c, "max_score", 0, 100)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string {
+			return "m.average_score <= " + a.add(maxScore)
+		}})
+	}
+
+	switch c.Query("adult") {
+	case "":
+	case "true":
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string { return "m.is_adult" }})
+	case "false":
+		filters = append(filters, browseFilter{"", func(a *sqlArgs) string { return "NOT COALESCE(m.is_adult, FALSE)" }})
+	default:
+		return nil, fmt.Errorf("adult must be true or false")
+	}
+
+	return filters, nil
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type BrowseFacets struct {
+	Genres    []FacetCount `json:"genres"`
+	Tags      []FacetCount `json:"tags"`
+	Status    []FacetCount `json:"status"`
+	Countries []FacetCount `json:"countries"`
+}
+
+// browseFacets counts matching manga per genre, tag, status and country.
+// Each facet ignores its own filter, so picking "Romance" still shows how
+// many results "Drama" would give.
+func browseFacets(c *gin.Context, conn *sql.DB, filters browseFilters) (*BrowseFacets, int, error) {
+	count := func(facet string, valueSQL string, from string, limit int) ([]FacetCount, error) {
+		var args sqlArgs
+		query := fmt.Sprintf(`SELECT %s AS value, COUNT(*) FROM manga m %s
+			WHERE %s AND %s IS NOT NULL
+			GROUP BY 1 ORDER BY 2 DESC, 1`, valueSQL, from, filters.where(facet, &args), valueSQL)
+		if limit > 0 {
+			query += " LIMIT " + args.add(limit)
+		}
+		rows, err := conn.QueryContext(c.Request.Context(), query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		counts := []FacetCount{}
+		for rows.Next() {
+			var f FacetCount
+			if err := rows.Scan(&f.Value, &f.Count); err != nil {
+				return nil, err
+			}
+			counts = append(counts, f)
+		}
+		return counts, rows.Err()
+	}
+
+	var facets BrowseFacets
+	var err error
+	if facets.Genres, err = count("genres", "g.value", ", unnest(m.genres) AS g(value)", 0); err != nil {
+		return nil, 0, err
+	}
+	if facets.Tags, err = count("tags", "t.value", ", unnest(m.tags) AS t(value)", maxTagFacets); err != nil {
+		return nil, 0, err
+	}
+	if facets.Status, err = count("status", "m.status", "", 0); err != nil {
+		return nil, 0, err
+	}
+	if facets.Countries, err = count("country_of_origin", "m.country_of_origin", "", 0); err != nil {
+		return nil, 0, err
+	}
+
+	var args sqlArgs
+	var total int
+	err = conn.QueryRowContext(c.Request.Context(),
+		`SELECT COUNT(*) FROM manga m WHERE `+filters.where("", &args), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &facets, total, nil
+}
+
+// get_mangas is the catalog browse endpoint. On top of the filters in
+// parseBrowseFilters it takes sort (popularity, score, title, start_date,
+// volumes) and order (asc, desc). Pages are keyset based: pass the previous
+// response's nextCursor as cursor. offset still works for old clients.
+// Facet counts and the total are only computed for the first page, or never
+// with facets=false.
+func get_mangas(c *gin.Context) {
+	godotenv.Load()
+
+	limit, offset, ok := pageParams(c, defaultBrowseLimit, maxBrowseLimit)
+	if !ok {
+		return
+	}
+
+	sortName := c.DefaultQuery("sort", "popularity")
+	sort, ok := browseSorts[sortName]
+	if !ok {
+		c.JSON(400, gin.H{"error": "sort must be one of popularity, score, title, start_date, volumes"})
+		return
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		sort.desc = false
+	case "desc":
+		sort.desc = true
+	default:
+		c.JSON(400, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+
+	var cursor *browseCursor
+	if raw := c.Query("cursor"); raw != "" {
+		cur, ok := decodeBrowseCursor(raw, sort)
+		if !ok || cur.Sort != sortName || cur.Desc != sort.desc {
+			c.JSON(400, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		cursor = &cur
+		offset = 0
+	}
+
+	filters, err := parseBrowseFilters(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := get_db_conn()
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	var args sqlArgs
+	where := filters.where("", &args)
+	direction, compare := "ASC", ">"
+	if sort.desc {
+		direction, compare = "DESC", "<"
+	}
+	if cursor != nil {
+		where += fmt.Sprintf(" AND (%s, m.id) %s (%s::%s, %s)",
+			sort.key, compare, args.add(cursor.Value), sort.cast, args.add(cursor.ID))
+	}
+
+	query := fmt.Sprintf(`SELECT m.id,
+			m.title_romaji,
+			m.title_english,
+			m.title_native,
+			m.description,
+			m.start_date,
+			m.end_date,
+			m.status,
+			m.total_volumes,
+			m.total_chapters, m.cover_image_s3_key,
+			m.genres, m.tags, m.country_of_origin, m.average_score, m.is_adult, m.popularity,
+			m.updated_at, %s::text FROM manga m
+			WHERE %s
+			ORDER BY %s %s, m.id %s LIMIT %s OFFSET %s`,
+		sort.key, where, sort.key, direction, direction, args.add(limit+1), args.add(offset))
+
+	rows, err := conn.QueryContext(c.Request.Context(), query, args...)
+
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	type Manga struct {
+		ID              int            `json:"id"`
+		TitleRomaji     sql.NullString `json:"title_romaji"`
+		TitleEnglish    sql.NullString `json:"title_english"`
+		TitleNative     sql.NullString `json:"title_native"`
+		Description     sql.NullString `json:"description"`
+		StartDate       sql.NullTime   `json:"start_date"`
+		EndDate         sql.NullTime   `json:"end_date"`
+		Status          sql.NullString `json:"status"`
+		TotalVolumes    sql.NullInt16  `json:"total_volumes"`
+		TotalChapters   sql.NullInt32  `json:"total_chapters"`
+		CoverImageS3Key sql.NullString `json:"cover_image_s3_key"`
+		Genres          pq.StringArray `json:"genres"`
+		Tags            pq.StringArray `json:"tags"`
+		CountryOfOrigin sql.NullString `json:"country_of_origin"`
+		AverageScore    sql.NullInt32  `json:"average_score"`
+		IsAdult         sql.NullBool   `json:"is_adult"`
+		Popularity      sql.NullInt64  `json:"popularity"`
+	}
+
+	mangas := []Manga{}
+	var sortValues []string
+
+	for rows.Next() {
+		var m Manga
+		var updatedAt sql.NullTime
+		var sortValue string
+		err := rows.Scan(
+			&m.ID,
+			&m.TitleRomaji,
+			&m.TitleEnglish,
+			&m.TitleNative,
+			&m.Description,
+			&m.StartDate,
+			&m.EndDate,
+			&m.Status,
+			&m.TotalVolumes,
+			&m.TotalChapters,
+			&m.CoverImageS3Key,
+			&m.Genres,
+			&m.Tags,
+			&m.CountryOfOrigin,
+			&m.AverageScore,
+			&m.IsAdult,
+			&m.Popularity,
+			&updatedAt,
+			&sortValue,
+		)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+
+		noteLastModified(c, updatedAt)
+		mangas = append(mangas, m)
+		sortValues = append(sortValues, sortValue)
+	}
+
+	// We fetch one extra row to detect "hasMore", then trim the result to the requested limit.
+	hasMore := len(mangas) > limit
+	if hasMore {
+		mangas = mangas[:limit]
+	}
+
+	type ResponseStruct struct {
+		Mangas     []Manga       `json:"mangas"`
+		HasMore    bool          `json:"hasMore"`
+		NextCursor *string       `json:"nextCursor"`
+		Total      *int          `json:"total,omitempty"`
+		Facets     *BrowseFacets `json:"facets,omitempty"`
+	}
+
+	data := ResponseStruct{
+		Mangas:  mangas,
+		HasMore: hasMore,
+	}
+
+	if hasMore {
+		last := len(mangas) - 1
+		next := browseCursor{sortName, sort.desc, sortValues[last], mangas[last].ID}.encode()
+		data.NextCursor = &next
+	}
+
+	if cursor == nil && offset == 0 && c.Query("facets") != "false" {
+		facets, total, err := browseFacets(c, conn, filters)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(500, gin.H{"error": "Failed to count facets"})
+			return
+		}
+		data.Facets = facets
+		data.Total = &total
+	}
+
+	c.JSON(200, data)
+}
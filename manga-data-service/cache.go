@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Catalog responses only change when the scraper or an approved submission
+// writes manga, volumes, editions or relations. Those tables NOTIFY
+// catalog_changed with the manga ID (migrations/019_catalog_cache.sql) and
+// every replica drops the affected entries, so the TTL is only a safety net
+// for changes that don't touch the series itself, like a related series
+// being renamed.
+
+const (
+	defaultCatalogCacheSize       = 1000
+	defaultCatalogCacheTTLSeconds = 300
+	lastModifiedKey               = "lastModified"
+)
+
+type cachedResponse struct {
+	key          string
+	mangaID      int // 0 for lists, which any change invalidates
+	contentType  string
+	body         []byte
+	etag         string
+	lastModified time.Time
+	expires      time.Time
+}
+
+// responseCache is a size-bounded LRU of successful catalog responses.
+type responseCache struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	order      *list.List // most recently used first
+	entries    map[string]*list.Element
+	generation uint64 // bumped by every invalidation
+}
+
+var catalogCache = newResponseCache(0, 0)
+
+func newResponseCache(size int, ttl time.Duration) *responseCache {
+	return &responseCache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (rc *responseCache) get(key string) (*cachedResponse, uint64, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, rc.generation, false
+	}
+	entry := el.Value.(*cachedResponse)
+	if time.Now().After(entry.expires) {
+		rc.order.Remove(el)
+		delete(rc.entries, key)
+		return nil, rc.generation, false
+	}
+	rc.order.MoveToFront(el)
+	return entry, rc.generation, true
+}
+
+// put stores entry unless the cache was invalidated since generation was
+// read, in which case entry may already be stale.
+func (rc *responseCache) put(entry *cachedResponse, generation uint64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.size <= 0 || generation != rc.generation {
+		return
+	}
+	entry.expires = time.Now().Add(rc.ttl)
+	if el, ok := rc.entries[entry.key]; ok {
+		el.Value = entry
+		rc.order.MoveToFront(el)
+		return
+	}
+	rc.entries[entry.key] = rc.order.PushFront(entry)
+	for rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// invalidateManga drops everything about mangaID, and every list since
+// the series may appear in any of them.
+func (rc *responseCache) invalidateManga(mangaID int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.generation++
+	for el := rc.order.Front(); el != nil; {
+		next := el.Next()
+		entry := el.Value.(*cachedResponse)
+		if entry.mangaID == mangaID || entry.mangaID == 0 {
+			rc.order.Remove(el)
+			delete(rc.entries, entry.key)
+		}
+		el = next
+	}
+}
+
+func (rc *responseCache) flush() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.generation++
+	rc.order.Init()
+	rc.entries = map[string]*list.Element{}
+}
+
+func envInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		fmt.Printf("Invalid %s, using the default\n", name)
+		return fallback
+	}
+	return n
+}
+
+// startCatalogCache sizes the cache from CATALOG_CACHE_SIZE (entries, 0
+// turns it off) and CATALOG_CACHE_TTL_SECONDS, and starts listening for
+// invalidations.
+func startCatalogCache() {
+	size := envInt("CATALOG_CACHE_SIZE", defaultCatalogCacheSize)
+	ttl := envInt("CATALOG_CACHE_TTL_SECONDS", defaultCatalogCacheTTLSeconds)
+	catalogCache = newResponseCache(size, time.Duration(ttl)*time.Second)
+	if size > 0 {
+		go listenCatalogChanges()
+	}
+}
+
+func listenCatalogChanges() {
+	listener := pq.NewListener(dbConnStr(), 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Println("catalog cache listener:", err)
+		}
+		// Changes made while disconnected are never delivered.
+		if ev == pq.ListenerEventDisconnected {
+			catalogCache.flush()
+		}
+	})
+	if err := listener.Listen("catalog_changed"); err != nil {
+		fmt.Println("catalog cache listener:", err)
+	}
+
+	for n := range listener.Notify {
+		// nil means the connection was re-established.
+		if n == nil {
+			catalogCache.flush()
+			continue
+		}
+		mangaID, err := strconv.Atoi(n.Extra)
+		if err != nil {
+			catalogCache.flush()
+			continue
+		}
+		catalogCache.invalidateManga(mangaID)
+	}
+}
+
+// noteLastModified lets a cached handler report the updated_at of what it
+// returned; the newest one becomes Last-Modified.
+func noteLastModified(c *gin.Context, t sql.NullTime) {
+	if !t.Valid {
+		return
+	}
+	if prev, ok := c.Get(lastModifiedKey); ok && !t.Time.After(prev.(time.Time)) {
+		return
+	}
+	c.Set(lastModifiedKey, t.Time)
+}
+
+// bufferedWriter holds a handler's response so it can be cached and
+// validated before anything is sent.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int)              { w.status = code }
+func (w *bufferedWriter) WriteHeaderNow()                   {}
+func (w *bufferedWriter) Write(b []byte) (int, error)       { return w.body.Write(b) }
+func (w *bufferedWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+func (w *bufferedWriter) Status() int                       { return w.status }
+func (w *bufferedWriter) Size() int                         { return w.body.Len() }
+func (w *bufferedWriter) Written() bool                     { return w.body.Len() > 0 }
+func (w *bufferedWriter) Flush()                            {}
+
+func (w *bufferedWriter) replay(to gin.ResponseWriter) (err error) {
+	to.WriteHeader(w.status)
+	_, err = to.Write(w.body.Bytes())
+	return err
+}
+
+// cached serves h through catalogCache with ETag and Last-Modified
+// validators, answering 304 when the client's copy is current. Only 200
+// responses are cached; errors pass straight through.
+func cached(maxAge time.Duration, h gin.HandlerFunc) gin.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+		entry, generation, ok := catalogCache.get(key)
+
+		if !ok {
+			original := c.Writer
+			buffered := &bufferedWriter{ResponseWriter: original, status: 200}
+			c.Writer = buffered
+			h(c)
+			c.Writer = original
+
+			if buffered.status != 200 {
+				if err := buffered.replay(original); err != nil {
+					fmt.Println(err)
+				}
+				return
+			}
+
+			var lastModified time.Time
+			if t, ok := c.Get(lastModifiedKey); ok {
+				lastModified = t.(time.Time).UTC().Truncate(time.Second)
+			}
+			hash := fnv.New64a()
+			hash.Write(buffered.body.Bytes())
+			mangaID, _ := strconv.Atoi(c.Param("manga_id"))
+
+			entry = &cachedResponse{
+				key:          key,
+				mangaID:      mangaID,
+				contentType:  original.Header().Get("Content-Type"),
+				body:         buffered.body.Bytes(),
+				etag:         fmt.Sprintf(`W/"%x-%x"`, lastModified.Unix(), hash.Sum64()),
+				lastModified: lastModified,
+			}
+			catalogCache.put(entry, generation)
+		}
+
+		c.Header("Cache-Control", cacheControl)
+		c.Header("ETag", entry.etag)
+		if !entry.lastModified.IsZero() {
+			c.Header("Last-Modified", entry.lastModified.Format(http.TimeFormat))
+		}
+		if notModified(c.Request, entry) {
+			c.Status(304)
+			return
+		}
+		c.Data(200, entry.contentType, entry.body)
+	}
+}
+
+// cachedForAnonymous is cached for handlers whose response includes the
+// caller's own data. Signed-in callers bypass the cache and get a private
+// response; shared caches are told the response varies by cookie.
+func cachedForAnonymous(maxAge time.Duration, h gin.HandlerFunc) gin.HandlerFunc {
+	anonymous := cached(maxAge, h)
+
+	return func(c *gin.Context) {
+		c.Header("Vary", "Cookie")
+		if _, ok := optionalUserID(c); ok {
+			c.Header("Cache-Control", "private, no-cache")
+			h(c)
+			return
+		}
+		anonymous(c)
+	}
+}
+
+// notModified applies If-None-Match, or If-Modified-Since when there is no
+// If-None-Match. ETags are compared weakly.
+func notModified(r *http.Request, entry *cachedResponse) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(entry.etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !entry.lastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !entry.lastModified.After(t)
+	}
+	return false
+}
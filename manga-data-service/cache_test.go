@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cachedForAnonymous must never hand one caller's response to another: the
+// anonymous entry is shared, signed-in callers always reach the handler.
+func TestCachedForAnonymous(t *testing.T) {
+	t.Setenv("SECRET_KEY", testSecretKey)
+	withCatalogCache(t)
+
+	calls := 0
+	router := gin.New()
+	router.GET("/:manga_id/volumes", cachedForAnonymous(time.Minute, func(c *gin.Context) {
+		calls++
+		caller := "anonymous"
+		if userID, ok := optionalUserID(c); ok {
+			caller = strconv.Itoa(userID)
+		}
+		c.String(200, caller)
+	}))
+
+	invalid := &http.Cookie{Name: "access_token", Value: "not-a-token"}
+	steps := []struct {
+		name        string
+		cookie      *http.Cookie
+		wantBody    string
+		wantCalls   int
+		wantPrivate bool
+		ifNoneMatch bool
+		wantStatus  int
+	}{
+		{"anonymous fills the cache", nil, "anonymous", 1, false, false, 200},
+		{"anonymous is served from the cache", nil, "anonymous", 1, false, false, 200},
+		{"signed-in bypasses the cache", authCookie(t, 7), "7", 2, true, false, 200},
+		{"another user gets their own response", authCookie(t, 8), "8", 3, true, false, 200},
+		{"anonymous still gets the anonymous entry", nil, "anonymous", 3, false, false, 200},
+		{"an invalid token is anonymous", invalid, "anonymous", 3, false, false, 200},
+		{"anonymous revalidates", nil, "", 3, false, true, 304},
+		{"signed-in never revalidates against the anonymous entry", authCookie(t, 7), "7", 4, true, true, 200},
+	}
+
+	var etag string
+	for _, step := range steps {
+		req, _ := http.NewRequest(http.MethodGet, "/1/volumes", nil)
+		if step.cookie != nil {
+			req.AddCookie(step.cookie)
+		}
+		if step.ifNoneMatch {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := serveRequest(router, req)
+
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s: status %d, want %d", step.name, w.Code, step.wantStatus)
+		}
+		if got := w.Body.String(); got != step.wantBody {
+			t.Errorf("%s: body %q, want %q", step.name, got, step.wantBody)
+		}
+		if calls != step.wantCalls {
+			t.Errorf("%s: handler ran %d times, want %d", step.name, calls, step.wantCalls)
+		}
+		if got := w.Header().Get("Vary"); got != "Cookie" {
+			t.Errorf("%s: Vary %q, want Cookie", step.name, got)
+		}
+		cacheControl := w.Header().Get("Cache-Control")
+		if step.wantPrivate && cacheControl != "private, no-cache" {
+			t.Errorf("%s: Cache-Control %q, want private", step.name, cacheControl)
+		}
+		if !step.wantPrivate && cacheControl != "public, max-age=60" {
+			t.Errorf("%s: Cache-Control %q, want public", step.name, cacheControl)
+		}
+		if etag == "" {
+			etag = w.Header().Get("ETag")
+		}
+	}
+}
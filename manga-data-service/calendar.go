@@ -0,0 +1,413 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const (
+	releaseDateLayout = "2006-01-02"
+	maxReleaseSpan    = 366 // days
+	maxReleasesLimit  = 200
+
+	// The iCalendar feed covers a window around today so calendar apps keep
+	// recent releases without downloading a series' whole back catalogue.
+	calendarPastDays   = 90
+	calendarFutureDays = 365
+)
+
+type Release struct {
+	VolumeID        int     `json:"volume_id"`
+	MangaID         int     `json:"manga_id"`
+	MangaTitle      *string `json:"manga_title"`
+	VolumeTitle     *string `json:"volume_title"`
+	VolumeNumber    *int    `json:"volume_number"`
+	Publisher       *string `json:"publisher"`
+	PublishedDate   string  `json:"published_date"`
+	ISBN13          *string `json:"isbn_13"`
+	ThumbnailS3Key  *string `json:"thumbnail_s3_key"`
+	CoverImageS3Key *string `json:"cover_image_s3_key"`
+}
+
+type CalendarFeed struct {
+	Token     string    `json:"token"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const releaseColumns = `v.id, v.manga_id,
+	COALESCE(m.title_english, m.title_romaji, m.title_native),
+	v.title, v.volume_number, v.publisher, v.published_date, v.isbn_13,
+	v.thumbnail_s3_key, m.cover_image_s3_key`
+
+func scanReleases(rows *sql.Rows) ([]Release, error) {
+	releases := []Release{}
+	for rows.Next() {
+		var r Release
+		var published time.Time
+		err := rows.Scan(&r.VolumeID, &r.MangaID, &r.MangaTitle, &r.VolumeTitle, &r.VolumeNumber,
+			&r.Publisher, &published, &r.ISBN13, &r.ThumbnailS3Key, &r.CoverImageS3Key)
+		if err != nil {
+			return nil, err
+		}
+		r.PublishedDate = published.Format(releaseDateLayout)
+		releases = append(releases, r)
+	}
+	return releases, rows.Err()
+}
+
+func parseReleaseDate(value string, fallback time.Time) (time.Time, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	t, err := time.Parse(releaseDateLayout, value)
+	return t, err == nil
+}
+
+// get_releases lists volumes published between from and to (inclusive),
+// defaulting to the last 30 and next 90 days. publisher matches case
+// insensitively and manga_id narrows it to one series.
+func get_releases(c *gin.Context) {
+	godotenv.Load()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, ok := parseReleaseDate(c.Query("from"), today.AddDate(0, 0, -30))
+	if !ok {
+		c.JSON(400, gin.H{"error": "from must be a YYYY-MM-DD date"})
+		return
+	}
+	to, ok := parseReleaseDate(c.Query("to"), today.AddDate(0, 0, 90))
+	if !ok {
+		c.JSON(400, gin.H{"error": "to must be a YYYY-MM-DD date"})
+		return
+	}
+	if to.Before(from) {
+		c.JSON(400, gin.H{"error": "to can't be before from"})
+		return
+	}
+	if to.Sub(from) > maxReleaseSpan*24*time.Hour {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Date range can't be longer than %d days", maxReleaseSpan)})
+		return
+	}
+
+	mangaID, ok := queryID(c, "manga_id", "manga")
+	if !ok {
+		return
+	}
+	publisher := strings.TrimSpace(c.Query("publisher"))
+
+	limit, offset, ok := pageParams(c, 50, maxReleasesLimit)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(c.Request.Context(), `SELECT `+releaseColumns+`
+		FROM volumes v
+		JOIN manga m ON m.id = v.manga_id
+		WHERE v.published_date BETWEEN $1 AND $2
+		AND ($3 = '' OR lower(v.publisher) = lower($3))
+		AND ($4 = 0 OR v.manga_id = $4)
+		ORDER BY v.published_date, m.title_english, v.volume_number NULLS LAST, v.id
+		LIMIT $5 OFFSET $6`, from.Format(releaseDateLayout), to.Format(releaseDateLayout), publisher, mangaID, limit+1, offset)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	releases, err := scanReleases(rows)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to scan row"})
+		return
+	}
+
+	hasMore := len(releases) > limit
+	if hasMore {
+		releases = releases[:limit]
+	}
+
+	c.JSON(200, gin.H{
+		"releases": releases,
+		"from":     from.Format(releaseDateLayout),
+		"to":       to.Format(releaseDateLayout),
+		"hasMore":  hasMore,
+	})
+}
+
+func newCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func loadCalendarFeed(conn *sql.DB, userID int) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := conn.QueryRow(`SELECT token, created_at FROM calendar_feeds WHERE user_id = $1`, userID).
+		Scan(&feed.Token, &feed.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	feed.Path = "/mangas/calendar/feed/" + feed.Token + ".ics"
+	return &feed, nil
+}
+
+func getCalendarFeed(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	feed, err := loadCalendarFeed(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get calendar feed"})
+		return
+	}
+	if feed == nil {
+		c.JSON(404, gin.H{"error": "You don't have a calendar feed"})
+		return
+	}
+	c.JSON(200, feed)
+}
+
+// createCalendarFeed turns on the caller's feed. Calling it again rotates the
+// token, so existing subscriptions stop updating.
+func createCalendarFeed(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	token, err := newCalendarToken()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(`
+		INSERT INTO calendar_feeds (user_id, token, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()
+	`, userID, token)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+
+	feed, err := loadCalendarFeed(conn, userID)
+	if err != nil || feed == nil {
+		c.JSON(500, gin.H{"error": "Failed to get calendar feed"})
+		return
+	}
+	c.JSON(200, feed)
+}
+
+func deleteCalendarFeed(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := conn.Exec(`DELETE FROM calendar_feeds WHERE user_id = $1`, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete calendar feed"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "You don't have a calendar feed"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
+
+// calendarFeed serves releases for every series the token's owner has
+// collected or wishlisted as an iCalendar file. It needs no login, since
+// calendar apps fetch it on their own; the token stands in for the cookie.
+func calendarFeed(c *gin.Context) {
+	godotenv.Load()
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.String(500, "Server error")
+		return
+	}
+	defer conn.Close()
+
+	var userID int
+	err = conn.QueryRow(`SELECT user_id FROM calendar_feeds WHERE token = $1`, token).Scan(&userID)
+	if err == sql.ErrNoRows {
+		c.String(404, "Calendar not found")
+		return
+	}
+	if err != nil {
+		c.String(500, "Server error")
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	rows, err := conn.QueryContext(c.Request.Context(), `SELECT `+releaseColumns+`
+		FROM volumes v
+		JOIN manga m ON m.id = v.manga_id
+		WHERE v.manga_id IN (
+			SELECT DISTINCT sv.manga_id
+			FROM user_manga um
+			JOIN volumes sv ON sv.id = um.manga_volume_id
+			WHERE um.user_id = $1 AND um.status IN ('collected', 'wishlisted')
+		)
+		AND v.published_date BETWEEN $2 AND $3
+		ORDER BY v.published_date, v.id`,
+		userID, today.AddDate(0, 0, -calendarPastDays).Format(releaseDateLayout),
+		today.AddDate(0, 0, calendarFutureDays).Format(releaseDateLayout))
+	if err != nil {
+		fmt.Println(err)
+		c.String(500, "Server error")
+		return
+	}
+	defer rows.Close()
+
+	releases, err := scanReleases(rows)
+	if err != nil {
+		fmt.Println(err)
+		c.String(500, "Server error")
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="mangacollect-releases.ics"`)
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(200, "text/calendar; charset=utf-8", []byte(buildReleaseCalendar(releases, time.Now().UTC())))
+}
+
+// buildReleaseCalendar renders releases as all-day events. UIDs only depend
+// on the volume, so a changed release date moves the event rather than
+// duplicating it.
+func buildReleaseCalendar(releases []Release, now time.Time) string {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldICSLine(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//MangaCollect//Release Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:MangaCollect releases")
+	line("REFRESH-INTERVAL;VALUE=DURATION:PT12H")
+	line("X-PUBLISHED-TTL:PT12H")
+
+	stamp := now.Format("20060102T150405Z")
+	for _, r := range releases {
+		day, err := time.Parse(releaseDateLayout, r.PublishedDate)
+		if err != nil {
+			continue
+		}
+
+		title := "Untitled"
+		if r.MangaTitle != nil {
+			title = *r.MangaTitle
+		}
+		if r.VolumeNumber != nil {
+			title = fmt.Sprintf("%s, Vol. %d", title, *r.VolumeNumber)
+		} else if r.VolumeTitle != nil && *r.VolumeTitle != title {
+			title = *r.VolumeTitle
+		}
+
+		var details []string
+		if r.VolumeTitle != nil && *r.VolumeTitle != "" {
+			details = append(details, *r.VolumeTitle)
+		}
+		if r.Publisher != nil && *r.Publisher != "" {
+			details = append(details, "Publisher: "+*r.Publisher)
+		}
+		if r.ISBN13 != nil && *r.ISBN13 != "" {
+			details = append(details, "ISBN: "+*r.ISBN13)
+		}
+
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:volume-%d@mangacollect", r.VolumeID))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + day.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + day.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + escapeICSText(title))
+		if len(details) > 0 {
+			line("DESCRIPTION:" + escapeICSText(strings.Join(details, "\n")))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+func escapeICSText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// foldICSLine splits content lines longer than 75 octets as RFC 5545
+// requires, without cutting a UTF-8 sequence in half.
+func foldICSLine(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
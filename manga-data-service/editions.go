@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+type Edition struct {
+	ID            int     `json:"id"`
+	MangaID       int     `json:"manga_id"`
+	Name          string  `json:"name"`
+	Language      *string `json:"language"`
+	PublisherID   *int    `json:"publisher_id"`
+	PublisherName *string `json:"publisher_name"`
+	Format        string  `json:"format"`
+	IsDefault     bool    `json:"is_default"`
+	VolumeCount   int     `json:"volume_count"`
+}
+
+// get_editions lists the editions of a series, default first, so clients
+// can offer an edition picker before listing volumes.
+func get_editions(c *gin.Context) {
+	godotenv.Load()
+
+	mangaID, ok := pathID(c, "manga_id", "manga")
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT e.id, e.manga_id, e.name, e.language, e.publisher_id, p.name, e.format, e.is_default,
+		       (SELECT COUNT(*) FROM volumes v WHERE v.edition_id = e.id)
+		FROM editions e
+		LEFT JOIN publishers p ON p.id = e.publisher_id
+		WHERE e.manga_id = $1
+		ORDER BY e.is_default DESC, e.name, e.id`, mangaID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	editions := []Edition{}
+	for rows.Next() {
+		var e Edition
+		err := rows.Scan(&e.ID, &e.MangaID, &e.Name, &e.Language, &e.PublisherID, &e.PublisherName,
+			&e.Format, &e.IsDefault, &e.VolumeCount)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		editions = append(editions, e)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+
+	if len(editions) == 0 {
+		exists, err := mangaExists(c.Request.Context(), conn, mangaID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to query database"})
+			return
+		}
+		if !exists {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"editions": editions})
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultEntityLimit = 20
+	maxEntityLimit     = 100
+)
+
+type Creator struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Works   int      `json:"works"`
+}
+
+type CreatorWork struct {
+	ID              int      `json:"id"`
+	TitleRomaji     *string  `json:"title_romaji"`
+	TitleEnglish    *string  `json:"title_english"`
+	TitleNative     *string  `json:"title_native"`
+	Status          *string  `json:"status"`
+	StartDate       *string  `json:"start_date"`
+	CoverImageS3Key *string  `json:"cover_image_s3_key"`
+	Roles           []string `json:"roles"`
+}
+
+type Publisher struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Series  int      `json:"series"`
+	Volumes int      `json:"volumes"`
+}
+
+type PublisherSeries struct {
+	ID              int     `json:"id"`
+	TitleRomaji     *string `json:"title_romaji"`
+	TitleEnglish    *string `json:"title_english"`
+	TitleNative     *string `json:"title_native"`
+	CoverImageS3Key *string `json:"cover_image_s3_key"`
+	Volumes         int     `json:"volumes"`
+}
+
+type PublisherVolume struct {
+	ID             int     `json:"id"`
+	MangaID        int     `json:"manga_id"`
+	MangaTitle     *string `json:"manga_title"`
+	Title          *string `json:"title"`
+	VolumeNumber   *int    `json:"volume_number"`
+	ISBN13         *string `json:"isbn_13"`
+	PublishedDate  *string `json:"published_date"`
+	ThumbnailS3Key *string `json:"thumbnail_s3_key"`
+}
+
+// normalizeEntityName mirrors normalize_entity_name in
+// migrations/016_creators_publishers.sql, so q is compared against aliases
+// normalized the same way.
+func normalizeEntityName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// get_creators lists authors and artists, most prolific first. q matches
+// any alias, ignoring case and small typos.
+func get_creators(c *gin.Context) {
+	godotenv.Load()
+	q := normalizeEntityName(c.Query("q"))
+	limit, offset, ok := pageParams(c, defaultEntityLimit, maxEntityLimit)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT cr.id, cr.name,
+		       ARRAY(SELECT alias FROM creator_aliases WHERE creator_id = cr.id ORDER BY alias),
+		       (SELECT COUNT(DISTINCT manga_id) FROM manga_creators WHERE creator_id = cr.id) AS works
+		FROM creators cr
+		WHERE $1 = '' OR EXISTS (
+			SELECT 1 FROM creator_aliases ca
+			WHERE ca.creator_id = cr.id
+			AND (ca.normalized_alias LIKE $4 OR ca.normalized_alias % $1)
+		)
+		ORDER BY works DESC, cr.name, cr.id
+		LIMIT $2 OFFSET $3`, q, limit+1, offset, likeContains(q))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	creators := []Creator{}
+	for rows.Next() {
+		var cr Creator
+		var aliases pq.StringArray
+		if err := rows.Scan(&cr.ID, &cr.Name, &aliases, &cr.Works); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		cr.Aliases = aliases
+		creators = append(creators, cr)
+	}
+
+	hasMore := len(creators) > limit
+	if hasMore {
+		creators = creators[:limit]
+	}
+	c.JSON(200, gin.H{"creators": creators, "hasMore": hasMore})
+}
+
+// creator_by_id returns a creator with every series they wrote or drew.
+func creator_by_id(c *gin.Context) {
+	godotenv.Load()
+	creatorID, ok := pathID(c, "creator_id", "creator")
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	var creator Creator
+	var aliases pq.StringArray
+	err = conn.QueryRowContext(c.Request.Context(), `
+		SELECT cr.id, cr.name,
+		       ARRAY(SELECT alias FROM creator_aliases WHERE creator_id = cr.id ORDER BY alias),
+		       (SELECT COUNT(DISTINCT manga_id) FROM manga_creators WHERE creator_id = cr.id)
+		FROM creators cr
+		WHERE cr.id = $1`, creatorID).Scan(&creator.ID, &creator.Name, &aliases, &creator.Works)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Creator not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	creator.Aliases = aliases
+
+	rows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT m.id, m.title_romaji, m.title_english, m.title_native, m.status,
+		       to_char(m.start_date, 'YYYY-MM-DD'), m.cover_image_s3_key,
+		       array_agg(mc.role ORDER BY mc.role)
+		FROM manga_creators mc
+		JOIN manga m ON m.id = mc.manga_id
+		WHERE mc.creator_id = $1
+		GROUP BY m.id
+		ORDER BY m.start_date NULLS LAST, m.id`, creatorID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	works := []CreatorWork{}
+	for rows.Next() {
+		var w CreatorWork
+		var roles pq.StringArray
+		err := rows.Scan(&w.ID, &w.TitleRomaji, &w.TitleEnglish, &w.TitleNative, &w.Status,
+			&w.StartDate, &w.CoverImageS3Key, &roles)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		w.Roles = roles
+		works = append(works, w)
+	}
+
+	c.JSON(200, gin.H{"creator": creator, "works": works})
+}
+
+// get_publishers lists publishers with the most volumes first. q matches
+// any alias, ignoring case and small typos.
+func get_publishers(c *gin.Context) {
+	godotenv.Load()
+	q := normalizeEntityName(c.Query("q"))
+	limit, offset, ok := pageParams(c, defaultEntityLimit, maxEntityLimit)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT p.id, p.name,
+		       ARRAY(SELECT alias FROM publisher_aliases WHERE publisher_id = p.id ORDER BY alias),
+		       COUNT(DISTINCT v.manga_id), COUNT(v.id) AS volumes
+		FROM publishers p
+		LEFT JOIN volumes v ON v.publisher_id = p.id
+		WHERE $1 = '' OR EXISTS (
+			SELECT 1 FROM publisher_aliases pa
+			WHERE pa.publisher_id = p.id
+			AND (pa.normalized_alias LIKE $4 OR pa.normalized_alias % $1)
+		)
+		GROUP BY p.id
+		ORDER BY volumes DESC, p.name, p.id
+		LIMIT $2 OFFSET $3`, q, limit+1, offset, likeContains(q))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	publishers := []Publisher{}
+	for rows.Next() {
+		var p Publisher
+		var aliases pq.StringArray
+		if err := rows.Scan(&p.ID, &p.Name, &aliases, &p.Series, &p.Volumes); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		p.Aliases = aliases
+		publishers = append(publishers, p)
+	}
+
+	hasMore := len(publishers) > limit
+	if hasMore {
+		publishers = publishers[:limit]
+	}
+	c.JSON(200, gin.H{"publishers": publishers, "hasMore": hasMore})
+}
+
+// publisher_by_id returns a publisher, the series it publishes and a page
+// of its volumes, newest first. manga_id narrows the volumes to one series.
+func publisher_by_id(c *gin.Context) {
+	godotenv.Load()
+	publisherID, ok := pathID(c, "publisher_id", "publisher")
+	if !ok {
+		return
+	}
+	mangaID, ok := queryID(c, "manga_id", "manga")
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(c, defaultEntityLimit, maxEntityLimit)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	var publisher Publisher
+	var aliases pq.StringArray
+	err = conn.QueryRowContext(c.Request.Context(), `
+		SELECT p.id, p.name,
+		       ARRAY(SELECT alias FROM publisher_aliases WHERE publisher_id = p.id ORDER BY alias),
+		       (SELECT COUNT(DISTINCT manga_id) FROM volumes WHERE publisher_id = p.id),
+		       (SELECT COUNT(*) FROM volumes WHERE publisher_id = p.id)
+		FROM publishers p
+		WHERE p.id = $1`, publisherID).Scan(&publisher.ID, &publisher.Name, &aliases, &publisher.Series, &publisher.Volumes)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Publisher not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	publisher.Aliases = aliases
+
+	seriesRows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT m.id, m.title_romaji, m.title_english, m.title_native, m.cover_image_s3_key, COUNT(v.id)
+		FROM volumes v
+		JOIN manga m ON m.id = v.manga_id
+		WHERE v.publisher_id = $1
+		GROUP BY m.id
+		ORDER BY COUNT(v.id) DESC, m.popularity DESC NULLS LAST, m.id`, publisherID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer seriesRows.Close()
+
+	series := []PublisherSeries{}
+	for seriesRows.Next() {
+		var s PublisherSeries
+		err := seriesRows.Scan(&s.ID, &s.TitleRomaji, &s.TitleEnglish, &s.TitleNative, &s.CoverImageS3Key, &s.Volumes)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		series = append(series, s)
+	}
+
+	volumeRows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT v.id, v.manga_id, COALESCE(m.title_english, m.title_romaji, m.title_native), v.title,
+		       v.volume_number, v.isbn_13, to_char(v.published_date, 'YYYY-MM-DD'), v.thumbnail_s3_key
+		FROM volumes v
+		JOIN manga m ON m.id = v.manga_id
+		WHERE v.publisher_id = $1 AND ($2 = 0 OR v.manga_id = $2)
+		ORDER BY v.published_date DESC NULLS LAST, v.id DESC
+		LIMIT $3 OFFSET $4`, publisherID, mangaID, limit+1, offset)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer volumeRows.Close()
+
+	volumes := []PublisherVolume{}
+	for volumeRows.Next() {
+		var v PublisherVolume
+		err := volumeRows.Scan(&v.ID, &v.MangaID, &v.MangaTitle, &v.Title, &v.VolumeNumber, &v.ISBN13,
+			&v.PublishedDate, &v.ThumbnailS3Key)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		volumes = append(volumes, v)
+	}
+
+	hasMore := len(volumes) > limit
+	if hasMore {
+		volumes = volumes[:limit]
+	}
+	c.JSON(200, gin.H{"publisher": publisher, "series": series, "volumes": volumes, "hasMore": hasMore})
+}
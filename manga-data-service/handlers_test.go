@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Bad IDs and limits are rejected before the handlers connect, so these run
+// without a database.
+func TestHandlersRejectBadParams(t *testing.T) {
+	router := newRouter()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/abc", "Invalid manga ID"},
+		{"/0", "Invalid manga ID"},
+		{"/-1/volumes", "Invalid manga ID"},
+		{"/1/volumes/x", "Invalid volume ID"},
+		{"/1/volumes/0", "Invalid volume ID"},
+		{"/1/volumes?edition_id=abc", "Invalid edition ID"},
+		{"/x/editions", "Invalid manga ID"},
+		{"/x/relations", "Invalid manga ID"},
+		{"/x/similar", "Invalid manga ID"},
+		{"/creators/abc", "Invalid creator ID"},
+		{"/publishers/abc", "Invalid publisher ID"},
+		{"/publishers/1?manga_id=abc", "Invalid manga ID"},
+		{"/releases?manga_id=-1", "Invalid manga ID"},
+
+		{"/1/volumes?limit=0", "limit must be a number from 1 to 100"},
+		{"/1/volumes?limit=101", "limit must be a number from 1 to 100"},
+		{"/1/volumes?limit=abc", "limit must be a number from 1 to 100"},
+		{"/1/volumes?offset=-1", "offset must be a non-negative number"},
+		{"/1/similar?limit=31", "limit must be a number from 1 to 30"},
+		{"/creators?limit=101", "limit must be a number from 1 to 100"},
+		{"/publishers?offset=x", "offset must be a non-negative number"},
+		{"/autocomplete?q=naruto&limit=11", "limit must be a number from 1 to 10"},
+
+		{"/?cursor=not-base64!", "Invalid cursor"},
+		{"/?cursor=" + browseCursor{"score", true, "1", 1}.encode(), "Invalid cursor"},
+		{"/?cursor=" + browseCursor{"popularity", true, "abc", 1}.encode(), "Invalid cursor"},
+		{"/?sort=start_date&cursor=" + browseCursor{"start_date", true, "2024-13-01", 1}.encode(), "Invalid cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(router, tt.path, nil)
+			if w.Code != 400 || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("got %d %s, want 400 mentioning %q", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlersNotFound(t *testing.T) {
+	conn := newTestDB(t)
+	router := newRouter()
+
+	mangaID := seedManga(t, conn, "Not Found Test")
+	seedVolume(t, conn, mangaID, 1)
+	// Serial IDs never get near this.
+	const missing = 2147483647
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{fmt.Sprintf("/%d", missing), "Manga not found"},
+		{fmt.Sprintf("/%d/volumes", missing), "Manga not found"},
+		{fmt.Sprintf("/%d/volumes/1", missing), "Volume not found"},
+		{fmt.Sprintf("/%d/volumes/%d", mangaID, missing), "Volume not found"},
+		{fmt.Sprintf("/%d/editions", missing), "Manga not found"},
+		{fmt.Sprintf("/%d/relations", missing), "Manga not found"},
+		{fmt.Sprintf("/%d/similar", missing), "Manga not found"},
+		{fmt.Sprintf("/creators/%d", missing), "Creator not found"},
+		{fmt.Sprintf("/publishers/%d", missing), "Publisher not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(router, tt.path, nil)
+			if w.Code != 404 || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("got %d %s, want 404 mentioning %q", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestVolumeListLimitBounds(t *testing.T) {
+	conn := newTestDB(t)
+	router := newRouter()
+
+	mangaID := seedManga(t, conn, "Limit Test")
+	seedVolume(t, conn, mangaID, 1)
+	seedVolume(t, conn, mangaID, 2)
+
+	tests := []struct {
+		query       string
+		wantVolumes int
+		wantHasMore bool
+	}{
+		{"?limit=1", 1, true},
+		{"?limit=2", 2, false},
+		{"?limit=100", 2, false},
+		{"?limit=1&offset=1", 1, false},
+		{"?offset=2", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := serve(router, fmt.Sprintf("/%d/volumes%s", mangaID, tt.query), nil)
+			if w.Code != 200 {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var page struct {
+				Volumes []json.RawMessage `json:"volumes"`
+				HasMore bool              `json:"hasMore"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Volumes) != tt.wantVolumes || page.HasMore != tt.wantHasMore {
+				t.Errorf("got %d volumes, hasMore %v, want %d, %v",
+					len(page.Volumes), page.HasMore, tt.wantVolumes, tt.wantHasMore)
+			}
+		})
+	}
+}
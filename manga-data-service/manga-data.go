@@ -6,7 +6,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
-	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -22,15 +22,17 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func get_db_conn() (*sql.DB, error) {
+func dbConnStr() string {
 	db := os.Getenv("DATABASE")
 	host := os.Getenv("HOST")
 	port := os.Getenv("PORT")
 	user := os.Getenv("USER")
 	password := os.Getenv("PASSWORD")
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, password, host, port, db)
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, password, host, port, db)
+}
 
-	conn, err := sql.Open("postgres", connStr)
+func get_db_conn() (*sql.DB, error) {
+	conn, err := sql.Open("postgres", dbConnStr())
 	if err != nil {
 		return nil, err
 	}
@@ -62,6 +64,26 @@ func getUserIDFromCookie(c *gin.Context) (int, bool) {
 	return int(claims.UserID), true
 }
 
+// optionalUserID resolves the caller for endpoints that also serve
+// anonymous requests. A missing or invalid token just means anonymous.
+func optionalUserID(c *gin.Context) (int, bool) {
+	tokenString, err := c.Cookie("access_token")
+	if err != nil {
+		return 0, false
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
+		return []byte(os.Getenv("SECRET_KEY")), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, false
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		return 0, false
+	}
+	return int(claims.UserID), true
+}
+
 func getUsername(userID int) (string, bool) {
 	conn, err := get_db_conn()
 	if err != nil {
@@ -78,116 +100,13 @@ func getUsername(userID int) (string, bool) {
 	return username, true
 }
 
-func get_mangas(c *gin.Context) {
+func manga_by_id(c *gin.Context) {
 	godotenv.Load()
 
-	limitStr := c.DefaultQuery("limit", "20")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 20
-	}
-
-	offsetStr := c.DefaultQuery("offset", "0")
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil {
-		offset = 0
-	}
-
-	conn, err := get_db_conn()
-
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to connect to database"})
-		return
-	}
-	defer conn.Close()
-
-	rows, err := conn.QueryContext(c.Request.Context(), `SELECT id, 
-			title_romaji, 
-			title_english, 
-			title_native, 
-			description,
-			start_date,
-			end_date,
-			status,
-			total_volumes,
-			total_chapters, cover_image_s3_key FROM manga
-			ORDER BY POPULARITY DESC LIMIT $1 OFFSET $2`, limit+1, offset)
-
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to query database"})
+	mangaId, ok := pathID(c, "manga_id", "manga")
+	if !ok {
 		return
 	}
-	defer rows.Close()
-
-	type Manga struct {
-		ID              int            `json:"id"`
-		TitleRomaji     sql.NullString `json:"title_romaji"`
-		TitleEnglish    sql.NullString `json:"title_english"`
-		TitleNative     sql.NullString `json:"title_native"`
-		Description     sql.NullString `json:"description"`
-		StartDate       sql.NullTime   `json:"start_date"`
-		EndDate         sql.NullTime   `json:"end_date"`
-		Status          sql.NullString `json:"status"`
-		TotalVolumes    sql.NullInt16  `json:"total_volumes"`
-		TotalChapters   sql.NullInt32  `json:"total_chapters"`
-		CoverImageS3Key sql.NullString `json:"cover_image_s3_key"`
-	}
-
-	var mangas []Manga
-
-	for rows.Next() {
-		var m Manga
-		err := rows.Scan(
-			&m.ID,
-			&m.TitleRomaji,
-			&m.TitleEnglish,
-			&m.TitleNative,
-			&m.Description,
-			&m.StartDate,
-			&m.EndDate,
-			&m.Status,
-			&m.TotalVolumes,
-			&m.TotalChapters,
-			&m.CoverImageS3Key,
-		)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to scan row"})
-			return
-		}
-
-		mangas = append(mangas, m)
-	}
-
-	hasMore := len(mangas) > limit
-
-	// If we fetched one extra row to detect "hasMore", trim the result to the requested limit.
-	result := mangas
-	if hasMore {
-		if len(mangas) >= limit {
-			result = mangas[:limit]
-		} else {
-			// defensive fallback
-			result = mangas
-		}
-	}
-
-	type ResponseStruct struct {
-		Mangas  []Manga `json:"mangas"`
-		HasMore bool    `json:"hasMore"`
-	}
-
-	data := ResponseStruct{
-		Mangas:  result,
-		HasMore: hasMore,
-	}
-
-	c.JSON(200, data)
-}
-
-func manga_by_id(c *gin.Context) {
-	godotenv.Load()
-
-	mangaId := c.Param("manga_id")
 
 	conn, err := get_db_conn()
 
@@ -197,7 +116,7 @@ func manga_by_id(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	row := conn.QueryRow(`SELECT id, 
+	row := conn.QueryRowContext(c.Request.Context(), `SELECT id, 
 			title_romaji, 
 			title_english, 
 			title_native, 
@@ -206,7 +125,8 @@ func manga_by_id(c *gin.Context) {
 			end_date,
 			status,
 			total_volumes,
-			total_chapters, cover_image_s3_key FROM manga
+			total_chapters, cover_image_s3_key,
+			GREATEST(updated_at, relations_checked_at) FROM manga
 			WHERE id = $1`, mangaId)
 
 	type Manga struct {
@@ -221,9 +141,11 @@ func manga_by_id(c *gin.Context) {
 		TotalVolumes    sql.NullInt16  `json:"total_volumes"`
 		TotalChapters   sql.NullInt32  `json:"total_chapters"`
 		CoverImageS3Key sql.NullString `json:"cover_image_s3_key"`
+		Relations       []RelatedManga `json:"relations"`
 	}
 
 	var manga Manga
+	var updatedAt sql.NullTime
 	err = row.Scan(
 		&manga.ID,
 		&manga.TitleRomaji,
@@ -236,37 +158,53 @@ func manga_by_id(c *gin.Context) {
 		&manga.TotalVolumes,
 		&manga.TotalChapters,
 		&manga.CoverImageS3Key,
+		&updatedAt,
 	)
 
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Manga not found"})
+		return
+	}
 	if err != nil {
+		fmt.Println(err)
 		c.JSON(500, gin.H{"error": "Failed to scan row"})
 		return
 	}
+	noteLastModified(c, updatedAt)
+
+	manga.Relations, err = loadRelations(c.Request.Context(), conn, manga.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get relations"})
+		return
+	}
 
 	c.JSON(200, manga)
 }
 
 func volume_for_manga(c *gin.Context) {
-	mangaId := c.Param("manga_id")
-	volumeId := c.Param("volume_id")
-
-	// Check that query params are valid
-	if len(mangaId) == 0 || len(volumeId) == 0 {
-		if len(mangaId) == 0 {
-			c.JSON(404, gin.H{"error": "Manga not found!"})
-			return
-		} else {
-			c.JSON(404, gin.H{"error": "Manga volume not found!"})
-			return
-		}
+	godotenv.Load()
+	mangaId, ok := pathID(c, "manga_id", "manga")
+	if !ok {
+		return
+	}
+	volumeId, ok := pathID(c, "volume_id", "volume")
+	if !ok {
+		return
+	}
+	// user_col_status is the caller's own; anonymous callers get NULL.
+	var callerID sql.NullInt64
+	if userID, ok := optionalUserID(c); ok {
+		callerID = sql.NullInt64{Int64: int64(userID), Valid: true}
 	}
 
 	conn, err := get_db_conn()
 
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Server error"})
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
 		return
 	}
+	defer conn.Close()
 	// Define the struct to hold the result
 	type Volume struct {
 		MangaID        int             `json:"manga_id"`
@@ -287,12 +225,18 @@ func volume_for_manga(c *gin.Context) {
 		PriceAmount    sql.NullFloat64 `json:"price_amount"`
 		PriceCurrency  sql.NullString  `json:"price_currency"`
 		ThumbnailS3Key sql.NullString  `json:"thumbnail_s3_key"`
+		EditionID      sql.NullInt64   `json:"edition_id"`
+		EditionName    sql.NullString  `json:"edition_name"`
+		EditionFormat  sql.NullString  `json:"edition_format"`
+		OmnibusStart   sql.NullInt16   `json:"omnibus_start"`
+		OmnibusEnd     sql.NullInt16   `json:"omnibus_end"`
 		UserColStatus  sql.NullString  `json:"user_col_status"`
 	}
 
 	var volume Volume
+	var updatedAt sql.NullTime
 
-	row := conn.QueryRow(`SELECT v.manga_id, 
+	row := conn.QueryRowContext(c.Request.Context(), `SELECT v.manga_id, 
 			v.id as volume_id,
 			m.title_romaji, 
 			m.title_english, 
@@ -310,12 +254,19 @@ func volume_for_manga(c *gin.Context) {
 			v.price_amount,
 			v.price_currency,
 			v.thumbnail_s3_key,
+			v.edition_id,
+			e.name as edition_name,
+			e.format as edition_format,
+			v.omnibus_start,
+			v.omnibus_end,
+			GREATEST(v.updated_at, m.updated_at),
 			COALESCE(um.status, NULL) AS user_col_status
 			FROM volumes v
 			JOIN manga m on m.id = v.manga_id
-			LEFT JOIN user_manga um ON um.manga_volume_id = v.id
+			LEFT JOIN editions e ON e.id = v.edition_id
+			LEFT JOIN user_manga um ON um.manga_volume_id = v.id AND um.user_id = $3
 			WHERE v.manga_id = $1
-			AND v.id = $2`, mangaId, volumeId)
+			AND v.id = $2`, mangaId, volumeId, callerID)
 
 	err = row.Scan(
 		&volume.MangaID,
@@ -336,45 +287,63 @@ func volume_for_manga(c *gin.Context) {
 		&volume.PriceAmount,
 		&volume.PriceCurrency,
 		&volume.ThumbnailS3Key,
+		&volume.EditionID,
+		&volume.EditionName,
+		&volume.EditionFormat,
+		&volume.OmnibusStart,
+		&volume.OmnibusEnd,
+		&updatedAt,
 		&volume.UserColStatus,
 	)
 
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Volume not found"})
+		return
+	}
 	if err != nil {
-		fmt.Print(err)
+		fmt.Println(err)
 		c.JSON(500, gin.H{"error": "Failed to scan row"})
 		return
 	}
+	noteLastModified(c, updatedAt)
 
 	c.JSON(200, volume)
 }
 
-func get_volumes_for_manga(c *gin.Context) {
-	mangaId := c.Param("manga_id")
+const (
+	defaultVolumeLimit = 20
+	maxVolumeLimit     = 100
+)
 
-	limitStr := c.DefaultQuery("limit", "20")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 20
+func get_volumes_for_manga(c *gin.Context) {
+	godotenv.Load()
+	mangaId, ok := pathID(c, "manga_id", "manga")
+	if !ok {
+		return
 	}
-
-	offsetStr := c.DefaultQuery("offset", "0")
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil {
-		offset = 0
+	limit, offset, ok := pageParams(c, defaultVolumeLimit, maxVolumeLimit)
+	if !ok {
+		return
 	}
-
-	// Check that query params are valid
-	if len(mangaId) == 0 {
-		c.JSON(404, gin.H{"error": "Manga not found!"})
+	// Volumes of every edition are listed, default edition first, unless
+	// edition_id narrows them to one.
+	editionID, ok := queryID(c, "edition_id", "edition")
+	if !ok {
 		return
 	}
+	// user_col_status is the caller's own; anonymous callers get NULL.
+	var callerID sql.NullInt64
+	if userID, ok := optionalUserID(c); ok {
+		callerID = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
 
 	conn, err := get_db_conn()
 
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Server error"})
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
 		return
 	}
+	defer conn.Close()
 	// Define the struct to hold the result
 	type Volume struct {
 		MangaID        int             `json:"manga_id"`
@@ -395,12 +364,17 @@ func get_volumes_for_manga(c *gin.Context) {
 		PriceAmount    sql.NullFloat64 `json:"price_amount"`
 		PriceCurrency  sql.NullString  `json:"price_currency"`
 		ThumbnailS3Key sql.NullString  `json:"thumbnail_s3_key"`
+		EditionID      sql.NullInt64   `json:"edition_id"`
+		EditionName    sql.NullString  `json:"edition_name"`
+		EditionFormat  sql.NullString  `json:"edition_format"`
+		OmnibusStart   sql.NullInt16   `json:"omnibus_start"`
+		OmnibusEnd     sql.NullInt16   `json:"omnibus_end"`
 		UserColStatus  sql.NullString  `json:"user_col_status"`
 	}
 
-	var volumes []Volume
+	volumes := []Volume{}
 
-	rows, err := conn.Query(`
+	rows, err := conn.QueryContext(c.Request.Context(), `
 			SELECT v.manga_id, 
 				v.id as volume_id,
 				m.title_romaji, 
@@ -419,24 +393,34 @@ func get_volumes_for_manga(c *gin.Context) {
 				v.price_amount,
 				v.price_currency,
 				v.thumbnail_s3_key,
+				v.edition_id,
+				e.name as edition_name,
+				e.format as edition_format,
+				v.omnibus_start,
+				v.omnibus_end,
+				GREATEST(v.updated_at, m.updated_at),
 				COALESCE(um.status, NULL) as user_col_status
 			FROM volumes v
 			JOIN manga m on m.id = v.manga_id
-			LEFT JOIN user_manga um ON um.manga_volume_id = v.id
+			LEFT JOIN editions e ON e.id = v.edition_id
+			LEFT JOIN user_manga um ON um.manga_volume_id = v.id AND um.user_id = $5
 			WHERE v.manga_id = $1
-			ORDER BY v.volume_number
+			AND ($4 = 0 OR v.edition_id = $4)
+			ORDER BY e.is_default DESC NULLS LAST, e.name, v.edition_id, v.volume_number, v.id
 			LIMIT $2
 			OFFSET $3
-	`, mangaId, limit+1, offset)
+	`, mangaId, limit+1, offset, editionID, callerID)
 
 	if err != nil {
 		fmt.Println(err)
-		c.JSON(500, gin.H{"error": "Failed to scan row!"})
+		c.JSON(500, gin.H{"error": "Failed to query database"})
 		return
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var volume Volume
+		var updatedAt sql.NullTime
 
 		err = rows.Scan(
 			&volume.MangaID,
@@ -457,23 +441,42 @@ func get_volumes_for_manga(c *gin.Context) {
 			&volume.PriceAmount,
 			&volume.PriceCurrency,
 			&volume.ThumbnailS3Key,
+			&volume.EditionID,
+			&volume.EditionName,
+			&volume.EditionFormat,
+			&volume.OmnibusStart,
+			&volume.OmnibusEnd,
+			&updatedAt,
 			&volume.UserColStatus,
 		)
 
 		if err != nil {
 			fmt.Println(err)
-			c.JSON(500, gin.H{"error": "Failed to scan row!"})
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
 			return
 		}
+		noteLastModified(c, updatedAt)
 		volumes = append(volumes, volume)
 	}
 
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		fmt.Println(err)
-		c.JSON(500, gin.H{"error": "Failed to scan row"})
+		c.JSON(500, gin.H{"error": "Failed to query database"})
 		return
 	}
 
+	if len(volumes) == 0 {
+		exists, err := mangaExists(c.Request.Context(), conn, mangaId)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to query database"})
+			return
+		}
+		if !exists {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		}
+	}
+
 	type ResponseStruct struct {
 		Volumes []Volume `json:"volumes"`
 		HasMore bool     `json:"hasMore"`
@@ -493,190 +496,26 @@ func get_volumes_for_manga(c *gin.Context) {
 	c.JSON(200, data)
 }
 
-func search(c *gin.Context) {
-	fmt.Println("test")
-	godotenv.Load()
-
-	type SearchBody struct {
-		SearchFrom string `json:"searchFrom"` // collection, wishlist, general
-		By         string `json:"by"`         // manga, volume
-	}
-
-	query := c.Query("query")
-
-	var searchBody SearchBody
-
-	err := c.BindJSON(&searchBody)
-
-	fmt.Println("after")
-
-	if err != nil {
-		fmt.Println(err)
-		c.JSON(400, gin.H{"success": false, "error": "Invalid request!", "debug": err})
-		return
-	}
-
-	var userID int
-	if searchBody.SearchFrom != "general" {
-		userIDtemp, ok := getUserIDFromCookie(c)
-		if !ok {
-			return
-		}
-		userID = userIDtemp
-	}
-
-	if c.IsAborted() {
-		return
-	}
-
-	conn, err := get_db_conn()
-
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Server error"})
-		return
-	}
-
-	var rows *sql.Rows
-	var general = true
-
-	scenario := searchBody.By
-
-	switch scenario {
-	case "manga":
-		if searchBody.SearchFrom == "collected" || searchBody.SearchFrom == "wishlisted" {
-			general = false
-		} else if searchBody.SearchFrom != "general" {
-			fmt.Println(err)
-			c.JSON(400, gin.H{"error": "Invalid request!"})
-			return
-		}
-		if general == true {
-			rows, err = conn.Query(`SELECT id, title_english FROM manga
-			WHERE similarity(title_english, $1) > 0.1
-			ORDER BY similarity(title_english, $1) DESC`, query)
-			if err != nil {
-				fmt.Println(err)
-				c.JSON(500, gin.H{"error": "Failed to query"})
-				return
-			}
-		} else {
-			rows, err = conn.Query(`SELECT DISTINCT m.id, m.title_english, similarity(m.title_english, $3) as sim
-			FROM manga m
-			JOIN volumes v ON v.manga_id = m.id
-			JOIN user_manga um ON um.manga_volume_id = v.id
-			WHERE um.user_id = $1
-			AND um.status = $2
-			AND similarity(m.title_english, $3) > 0.1
-			ORDER BY similarity(m.title_english, $3) DESC`, userID, searchBody.SearchFrom, query)
-
-			if err != nil {
-				fmt.Println(err)
-				c.JSON(500, gin.H{"error": "Failed to query"})
-				return
-			}
-		}
-
-	case "volume":
-		if searchBody.SearchFrom == "collected" || searchBody.SearchFrom == "wishlisted" {
-			general = false
-		} else if searchBody.SearchFrom != "general" {
+func main() {
+	// "manga-data-service recommend" rebuilds the recommendation tables once,
+	// e.g. from cron.
+	if len(os.Args) > 1 && os.Args[1] == "recommend" {
+		godotenv.Load()
+		if err := rebuildRecommendations(); err != nil {
 			fmt.Println(err)
-			c.JSON(400, gin.H{"error": "Invalid request!"})
-			return
-		}
-		if general == true {
-			rows, err = conn.Query(`SELECT id, manga_id, title FROM volumes
-			WHERE similarity(title, $1) > 0.1
-			ORDER BY similarity(title, $1) DESC`, query)
-
-			if err != nil {
-				fmt.Println(err)
-				c.JSON(500, gin.H{"error": "Failed to query"})
-				return
-			}
-		} else {
-			rows, err = conn.Query(`SELECT DISTINCT v.id, v.manga_id, v.title, similarity(v.title, $3) as sim FROM volumes v
-			JOIN user_manga um ON um.manga_volume_id = v.id
-			WHERE um.user_id = $1
-			AND um.status = $2
-			AND similarity(v.title, $3) > 0.1
-			ORDER BY similarity(v.title, $3) DESC`, userID, searchBody.SearchFrom, query)
-
-			if err != nil {
-				fmt.Println(err)
-				c.JSON(500, gin.H{"error": "Failed to query"})
-				return
-			}
+			os.Exit(1)
 		}
-	default:
-		c.JSON(400, gin.H{"error": "Invalid parameters!"})
 		return
 	}
 
-	if rows == nil {
-		c.JSON(500, gin.H{"error": "Search query returned no result set"})
-		return
-	}
-
-	defer rows.Close()
+	godotenv.Load()
+	startCatalogCache()
+	go runRecommendationWorker()
 
-	var results []map[string]interface{}
-
-	switch scenario {
-	case "manga":
-		for rows.Next() {
-			var manga_id int
-			var text string
-			var similarity float32
-
-			if general != true {
-				err = rows.Scan(&manga_id, &text, &similarity)
-				if err != nil {
-					fmt.Println(err)
-					c.JSON(500, gin.H{"error": "Scan failed"})
-					return
-				}
-				results = append(results, map[string]interface{}{"id": manga_id, "text": text})
-			} else {
-				err = rows.Scan(&manga_id, &text)
-				if err != nil {
-					fmt.Println(err)
-					c.JSON(500, gin.H{"error": "Scan failed"})
-					return
-				}
-				results = append(results, map[string]interface{}{"id": manga_id, "text": text})
-			}
-		}
-	case "volume":
-		for rows.Next() {
-			var id int
-			var manga_id int
-			var text string
-			var similarity float32
-
-			if general != true {
-				err = rows.Scan(&id, &manga_id, &text, &similarity)
-				if err != nil {
-					fmt.Println(err)
-					c.JSON(500, gin.H{"error": "Scan failed"})
-					return
-				}
-				results = append(results, map[string]interface{}{"id": id, "manga_id": manga_id, "text": text})
-			} else {
-				err = rows.Scan(&id, &manga_id, &text)
-				if err != nil {
-					fmt.Println(err)
-					c.JSON(500, gin.H{"error": "Scan failed"})
-					return
-				}
-				results = append(results, map[string]interface{}{"id": id, "manga_id": manga_id, "text": text})
-			}
-		}
-	}
-	c.JSON(200, gin.H{"results": results, "by": searchBody.By, "searchFrom": searchBody.SearchFrom})
+	newRouter().Run(":8080") //8081 for testing, 8080 for prod
 }
 
-func main() {
+func newRouter() *gin.Engine {
 	router := gin.Default()
 
 	// Disable automatic redirect for trailing slashes
@@ -684,15 +523,39 @@ func main() {
 	router.RedirectFixedPath = false
 
 	// Manga routes
-	router.GET("/:manga_id", manga_by_id)
-	router.GET("/", get_mangas)
-
-	// Volume routes
-	router.GET("/:manga_id/volumes/:volume_id", volume_for_manga)
-	router.GET("/:manga_id/volumes", get_volumes_for_manga)
-
-	// Search route
-	router.POST("/search", search)
-
-	router.Run(":8080") //8081 for testing, 8080 for prod
+	router.GET("/:manga_id", cached(5*time.Minute, manga_by_id))
+	router.GET("/", cached(time.Minute, get_mangas))
+
+	// Volume routes. Signed-in callers get their own collection status, so
+	// only anonymous responses are cached.
+	router.GET("/:manga_id/volumes/:volume_id", cachedForAnonymous(5*time.Minute, volume_for_manga))
+	router.GET("/:manga_id/volumes", cachedForAnonymous(5*time.Minute, get_volumes_for_manga))
+	router.GET("/:manga_id/editions", get_editions)
+
+	// Relation routes
+	router.GET("/:manga_id/relations", relation_graph)
+
+	// Creator and publisher routes
+	router.GET("/creators", get_creators)
+	router.GET("/creators/:creator_id", creator_by_id)
+	router.GET("/publishers", get_publishers)
+	router.GET("/publishers/:publisher_id", publisher_by_id)
+
+	// Recommendation routes
+	router.GET("/:manga_id/similar", similar_mangas)
+	router.GET("/recommendations", get_recommendations)
+
+	// Search routes
+	router.GET("/v1/search", searchV1)
+	router.POST("/search", search) // deprecated, use GET /v1/search
+	router.GET("/autocomplete", autocomplete)
+
+	// Release calendar routes
+	router.GET("/releases", get_releases)
+	router.GET("/calendar/feed", getCalendarFeed)
+	router.POST("/calendar/feed", createCalendarFeed)
+	router.DELETE("/calendar/feed", deleteCalendarFeed)
+	router.GET("/calendar/feed/:token", calendarFeed)
+
+	return router
 }
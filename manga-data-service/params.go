@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request parsing shared by the handlers. Each helper answers 400 with the
+// usual {"error": ...} body itself and returns ok=false, so callers just
+// return.
+
+// pathID reads a positive integer path parameter such as manga_id. what
+// names it in the error, e.g. "manga".
+func pathID(c *gin.Context, name string, what string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id < 1 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid %s ID", what)})
+		return 0, false
+	}
+	return id, true
+}
+
+// queryID is pathID for optional query parameters; 0 means absent.
+func queryID(c *gin.Context, name string, what string) (int, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 1 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid %s ID", what)})
+		return 0, false
+	}
+	return id, true
+}
+
+// queryLimit reads limit, which must be from 1 to max when given.
+func queryLimit(c *gin.Context, fallback int, max int) (int, bool) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return fallback, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > max {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("limit must be a number from 1 to %d", max)})
+		return 0, false
+	}
+	return limit, true
+}
+
+// pageParams reads limit as queryLimit does and a non-negative offset.
+func pageParams(c *gin.Context, fallback int, max int) (limit int, offset int, ok bool) {
+	if limit, ok = queryLimit(c, fallback, max); !ok {
+		return 0, 0, false
+	}
+	if raw := c.Query("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			c.JSON(400, gin.H{"error": "offset must be a non-negative number"})
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// mangaExists tells an empty list for a series apart from a series that
+// doesn't exist.
+func mangaExists(ctx context.Context, conn *sql.DB, mangaID int) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM manga WHERE id = $1)`, mangaID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// paramContext is a gin context for GET target with the given path params.
+func paramContext(target string, params gin.Params) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	c.Params = params
+	return c, w
+}
+
+// checkRejected fails unless c wrote a 400 whose error mentions want, or
+// wrote nothing when ok.
+func checkRejected(t *testing.T, w *httptest.ResponseRecorder, ok bool, wantOK bool, want string) {
+	t.Helper()
+	if ok != wantOK {
+		t.Fatalf("ok = %v, want %v", ok, wantOK)
+	}
+	if wantOK {
+		if w.Body.Len() != 0 {
+			t.Errorf("wrote %q on success", w.Body)
+		}
+		return
+	}
+	if w.Code != 400 || !strings.Contains(w.Body.String(), want) {
+		t.Errorf("got %d %s, want 400 mentioning %q", w.Code, w.Body, want)
+	}
+}
+
+func TestPathID(t *testing.T) {
+	tests := []struct {
+		raw    string
+		want   int
+		wantOK bool
+	}{
+		{"1", 1, true},
+		{"42", 42, true},
+		{"0", 0, false},
+		{"-3", 0, false},
+		{"abc", 0, false},
+		{"1.5", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			c, w := paramContext("/", gin.Params{{Key: "manga_id", Value: tt.raw}})
+			got, ok := pathID(c, "manga_id", "manga")
+			checkRejected(t, w, ok, tt.wantOK, "Invalid manga ID")
+			if got != tt.want {
+				t.Errorf("pathID = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryID(t *testing.T) {
+	tests := []struct {
+		target string
+		want   int
+		wantOK bool
+	}{
+		{"/", 0, true},
+		{"/?edition_id=", 0, true},
+		{"/?edition_id=7", 7, true},
+		{"/?edition_id=0", 0, false},
+		{"/?edition_id=-1", 0, false},
+		{"/?edition_id=abc", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			c, w := paramContext(tt.target, nil)
+			got, ok := queryID(c, "edition_id", "edition")
+			checkRejected(t, w, ok, tt.wantOK, "Invalid edition ID")
+			if got != tt.want {
+				t.Errorf("queryID = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryLimit(t *testing.T) {
+	tests := []struct {
+		target string
+		want   int
+		wantOK bool
+	}{
+		{"/", 20, true},
+		{"/?limit=1", 1, true},
+		{"/?limit=100", 100, true},
+		{"/?limit=101", 0, false},
+		{"/?limit=0", 0, false},
+		{"/?limit=-5", 0, false},
+		{"/?limit=abc", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			c, w := paramContext(tt.target, nil)
+			got, ok := queryLimit(c, 20, 100)
+			checkRejected(t, w, ok, tt.wantOK, "limit must be a number from 1 to 100")
+			if got != tt.want {
+				t.Errorf("queryLimit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		target     string
+		wantLimit  int
+		wantOffset int
+		wantOK     bool
+		wantError  string
+	}{
+		{"/", 20, 0, true, ""},
+		{"/?limit=5&offset=10", 5, 10, true, ""},
+		{"/?offset=0", 20, 0, true, ""},
+		{"/?offset=-1", 0, 0, false, "offset must be a non-negative number"},
+		{"/?offset=abc", 0, 0, false, "offset must be a non-negative number"},
+		{"/?limit=101&offset=10", 0, 0, false, "limit must be a number from 1 to 100"},
+		{"/?limit=0", 0, 0, false, "limit must be a number from 1 to 100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			c, w := paramContext(tt.target, nil)
+			limit, offset, ok := pageParams(c, 20, 100)
+			checkRejected(t, w, ok, tt.wantOK, tt.wantError)
+			if limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("pageParams = %d, %d, want %d, %d", limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
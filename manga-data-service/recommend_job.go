@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	defaultRecommendIntervalHours = 24
+	// Pairs collected together by fewer users than this are treated as noise.
+	minCoOwners = 2
+	// How much of a similarity score comes from co-ownership; the rest comes
+	// from shared genres and tags.
+	coOwnerWeight = 0.7
+	// Genres and tags on more than this share of the catalogue say little
+	// about similarity and would make the content self-join huge.
+	maxFeatureShare  = 0.25
+	similarPerManga  = 30
+	recommendPerUser = 50
+)
+
+// buildSimilaritySQL rebuilds manga_similarity from collector co-occurrence
+// and genre/tag overlap. $1 minCoOwners, $2 coOwnerWeight, $3 maxFeatureShare,
+// $4 similarPerManga.
+const buildSimilaritySQL = `
+	WITH owners AS (
+		SELECT DISTINCT um.user_id, v.manga_id
+		FROM user_manga um
+		JOIN volumes v ON v.id = um.manga_volume_id
+		WHERE um.status = 'collected'
+	),
+	owner_counts AS (
+		SELECT manga_id, COUNT(*) AS n FROM owners GROUP BY manga_id
+	),
+	co AS (
+		SELECT a.manga_id, b.manga_id AS similar_manga_id, COUNT(*) AS co_owners
+		FROM owners a
+		JOIN owners b ON b.user_id = a.user_id AND b.manga_id <> a.manga_id
+		GROUP BY a.manga_id, b.manga_id
+		HAVING COUNT(*) >= $1
+	),
+	co_scored AS (
+		SELECT co.manga_id, co.similar_manga_id, co.co_owners,
+		       co.co_owners / sqrt(ca.n::float8 * cb.n) AS score
+		FROM co
+		JOIN owner_counts ca ON ca.manga_id = co.manga_id
+		JOIN owner_counts cb ON cb.manga_id = co.similar_manga_id
+	),
+	all_features AS (
+		SELECT m.id AS manga_id, 'genre:' || g AS feature FROM manga m, unnest(m.genres) AS g
+		UNION
+		SELECT m.id, 'tag:' || t FROM manga m, unnest(m.tags) AS t
+	),
+	features AS (
+		SELECT f.manga_id, f.feature
+		FROM all_features f
+		WHERE f.feature NOT IN (
+			SELECT feature FROM all_features
+			GROUP BY feature
+			HAVING COUNT(*) > (SELECT COUNT(*) FROM manga) * $3::float8
+		)
+	),
+	feature_counts AS (
+		SELECT manga_id, COUNT(*) AS n FROM features GROUP BY manga_id
+	),
+	shared AS (
+		SELECT a.manga_id, b.manga_id AS similar_manga_id, COUNT(*) AS shared
+		FROM features a
+		JOIN features b ON b.feature = a.feature AND b.manga_id <> a.manga_id
+		GROUP BY a.manga_id, b.manga_id
+	),
+	content AS (
+		SELECT s.manga_id, s.similar_manga_id,
+		       s.shared::float8 / (fa.n + fb.n - s.shared) AS score
+		FROM shared s
+		JOIN feature_counts fa ON fa.manga_id = s.manga_id
+		JOIN feature_counts fb ON fb.manga_id = s.similar_manga_id
+	),
+	combined AS (
+		SELECT COALESCE(co.manga_id, ct.manga_id) AS manga_id,
+		       COALESCE(co.similar_manga_id, ct.similar_manga_id) AS similar_manga_id,
+		       $2::float8 * COALESCE(co.score, 0) + (1 - $2::float8) * COALESCE(ct.score, 0) AS score,
+		       COALESCE(co.score, 0) AS co_owner_score,
+		       COALESCE(ct.score, 0) AS content_score,
+		       COALESCE(co.co_owners, 0) AS co_owners
+		FROM co_scored co
+		FULL JOIN content ct ON ct.manga_id = co.manga_id AND ct.similar_manga_id = co.similar_manga_id
+	),
+	ranked AS (
+		SELECT *, row_number() OVER (PARTITION BY manga_id ORDER BY score DESC, similar_manga_id) AS rank
+		FROM combined
+		WHERE score > 0
+	)
+	INSERT INTO manga_similarity (manga_id, similar_manga_id, score, co_owner_score, content_score, co_owners, computed_at)
+	SELECT manga_id, similar_manga_id, score, co_owner_score, content_score, co_owners, NOW()
+	FROM ranked
+	WHERE rank <= $4`
+
+// buildUserRecommendationsSQL scores every uncollected series by summing its
+// similarity to the series a user has collected. $1 recommendPerUser.
+const buildUserRecommendationsSQL = `
+	WITH owned AS (
+		SELECT DISTINCT um.user_id, v.manga_id
+		FROM user_manga um
+		JOIN volumes v ON v.id = um.manga_volume_id
+		WHERE um.status = 'collected'
+	),
+	candidates AS (
+		SELECT o.user_id, s.similar_manga_id AS manga_id, SUM(s.score) AS score,
+		       (array_agg(o.manga_id ORDER BY s.score DESC, o.manga_id))[1:3] AS because_manga_ids
+		FROM owned o
+		JOIN manga_similarity s ON s.manga_id = o.manga_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM owned x WHERE x.user_id = o.user_id AND x.manga_id = s.similar_manga_id
+		)
+		GROUP BY o.user_id, s.similar_manga_id
+	),
+	ranked AS (
+		SELECT *, row_number() OVER (PARTITION BY user_id ORDER BY score DESC, manga_id) AS rank
+		FROM candidates
+	)
+	INSERT INTO user_recommendations (user_id, manga_id, score, because_manga_ids, computed_at)
+	SELECT user_id, manga_id, score, because_manga_ids, NOW()
+	FROM ranked
+	WHERE rank <= $1`
+
+// runRecommendationWorker rebuilds the recommendation tables every
+// RECOMMEND_INTERVAL_HOURS (24 by default, 0 turns it off).
+func runRecommendationWorker() {
+	godotenv.Load()
+	hours := defaultRecommendIntervalHours
+	if raw := os.Getenv("RECOMMEND_INTERVAL_HOURS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			fmt.Println("Invalid RECOMMEND_INTERVAL_HOURS, using the default")
+		} else {
+			hours = n
+		}
+	}
+	if hours == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(hours) * time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := rebuildRecommendations(); err != nil {
+			fmt.Println("recommendations:", err)
+		}
+		<-ticker.C
+	}
+}
+
+// rebuildRecommendations replaces both tables in one transaction, so readers
+// keep seeing the previous results until it commits. An advisory lock makes
+// concurrent runs from other replicas skip instead of doing the work twice.
+func rebuildRecommendations() error {
+	conn, err := get_db_conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	var locked bool
+	err = tx.QueryRow(`SELECT pg_try_advisory_xact_lock(hashtext('manga_recommendations'))`).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		fmt.Println("recommendations: another run is in progress, skipping")
+		return nil
+	}
+
+	started := time.Now()
+	if _, err := tx.Exec(`DELETE FROM manga_similarity`); err != nil {
+		return err
+	}
+	result, err := tx.Exec(buildSimilaritySQL, minCoOwners, coOwnerWeight, maxFeatureShare, similarPerManga)
+	if err != nil {
+		return err
+	}
+	pairs, _ := result.RowsAffected()
+
+	if _, err := tx.Exec(`DELETE FROM user_recommendations`); err != nil {
+		return err
+	}
+	result, err = tx.Exec(buildUserRecommendationsSQL, recommendPerUser)
+	if err != nil {
+		return err
+	}
+	suggestions, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	rollback = false
+
+	fmt.Printf("recommendations: %d similar pairs, %d user suggestions in %s\n",
+		pairs, suggestions, time.Since(started).Round(time.Millisecond))
+	return nil
+}
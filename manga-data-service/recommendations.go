@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const (
+	defaultSimilarLimit   = 10
+	maxSimilarLimit       = 30
+	defaultRecommendLimit = 20
+	maxRecommendLimit     = 50
+)
+
+type SimilarManga struct {
+	ID              int     `json:"id"`
+	TitleRomaji     *string `json:"title_romaji"`
+	TitleEnglish    *string `json:"title_english"`
+	TitleNative     *string `json:"title_native"`
+	CoverImageS3Key *string `json:"cover_image_s3_key"`
+	Score           float64 `json:"score"`
+	CoOwners        int     `json:"co_owners"`
+}
+
+type RecommendationReason struct {
+	ID    int     `json:"id"`
+	Title *string `json:"title"`
+}
+
+type Recommendation struct {
+	ID              int                    `json:"id"`
+	TitleRomaji     *string                `json:"title_romaji"`
+	TitleEnglish    *string                `json:"title_english"`
+	TitleNative     *string                `json:"title_native"`
+	CoverImageS3Key *string                `json:"cover_image_s3_key"`
+	Score           float64                `json:"score"`
+	Because         []RecommendationReason `json:"because"`
+}
+
+// similar_mangas is "collectors who own this also own…". It reads what the
+// recommendation job last materialized, so new series have no results until
+// the next run.
+func similar_mangas(c *gin.Context) {
+	godotenv.Load()
+
+	mangaID, ok := pathID(c, "manga_id", "manga")
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(c, defaultSimilarLimit, maxSimilarLimit)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT m.id, m.title_romaji, m.title_english, m.title_native, m.cover_image_s3_key,
+		       s.score, s.co_owners
+		FROM manga_similarity s
+		JOIN manga m ON m.id = s.similar_manga_id
+		WHERE s.manga_id = $1
+		ORDER BY s.score DESC, m.id
+		LIMIT $2`, mangaID, limit)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	similar := []SimilarManga{}
+	for rows.Next() {
+		var m SimilarManga
+		err := rows.Scan(&m.ID, &m.TitleRomaji, &m.TitleEnglish, &m.TitleNative, &m.CoverImageS3Key,
+			&m.Score, &m.CoOwners)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		similar = append(similar, m)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+
+	if len(similar) == 0 {
+		exists, err := mangaExists(c.Request.Context(), conn, mangaID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to query database"})
+			return
+		}
+		if !exists {
+			c.JSON(404, gin.H{"error": "Manga not found"})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"similar": similar})
+}
+
+// get_recommendations returns the caller's personalized suggestions. Series
+// collected since the job last ran are filtered out here. Users without
+// suggestions yet (new accounts, empty collections) get popular series they
+// haven't collected, with personalized set to false.
+func get_recommendations(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(c, defaultRecommendLimit, maxRecommendLimit)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	const notCollected = `NOT EXISTS (
+		SELECT 1 FROM user_manga um
+		JOIN volumes v ON v.id = um.manga_volume_id
+		WHERE um.user_id = $1 AND um.status = 'collected' AND v.manga_id = m.id
+	)`
+
+	rows, err := conn.QueryContext(c.Request.Context(), `
+		SELECT m.id, m.title_romaji, m.title_english, m.title_native, m.cover_image_s3_key, r.score,
+		       COALESCE((
+		           SELECT json_agg(json_build_object(
+		                      'id', b.id,
+		                      'title', COALESCE(b.title_english, b.title_romaji, b.title_native))
+		                  ORDER BY array_position(r.because_manga_ids, b.id))
+		           FROM manga b
+		           WHERE b.id = ANY(r.because_manga_ids)
+		       ), '[]')
+		FROM user_recommendations r
+		JOIN manga m ON m.id = r.manga_id
+		WHERE r.user_id = $1
+		AND `+notCollected+`
+		ORDER BY r.score DESC, m.id
+		LIMIT $2`, userID, limit)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get recommendations"})
+		return
+	}
+	defer rows.Close()
+
+	recommendations := []Recommendation{}
+	for rows.Next() {
+		var r Recommendation
+		var because []byte
+		err := rows.Scan(&r.ID, &r.TitleRomaji, &r.TitleEnglish, &r.TitleNative, &r.CoverImageS3Key,
+			&r.Score, &because)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		if err := json.Unmarshal(because, &r.Because); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		recommendations = append(recommendations, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get recommendations"})
+		return
+	}
+
+	if len(recommendations) > 0 {
+		c.JSON(200, gin.H{"recommendations": recommendations, "personalized": true})
+		return
+	}
+
+	popular, err := conn.QueryContext(c.Request.Context(), `
+		SELECT m.id, m.title_romaji, m.title_english, m.title_native, m.cover_image_s3_key
+		FROM manga m
+		WHERE `+notCollected+`
+		AND NOT COALESCE(m.is_adult, FALSE)
+		ORDER BY m.popularity DESC NULLS LAST, m.id
+		LIMIT $2`, userID, limit)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get recommendations"})
+		return
+	}
+	defer popular.Close()
+
+	for popular.Next() {
+		r := Recommendation{Because: []RecommendationReason{}}
+		err := popular.Scan(&r.ID, &r.TitleRomaji, &r.TitleEnglish, &r.TitleNative, &r.CoverImageS3Key)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		recommendations = append(recommendations, r)
+	}
+
+	c.JSON(200, gin.H{"recommendations": recommendations, "personalized": false})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultRelationDepth = 2
+	maxRelationDepth     = 5
+	// The graph stops growing once this many series have been reached.
+	maxRelationNodes = 100
+)
+
+var relationTypes = map[string]bool{
+	"adaptation": true, "prequel": true, "sequel": true, "parent": true, "side_story": true,
+	"character": true, "summary": true, "alternative": true, "spin_off": true, "other": true,
+	"source": true, "compilation": true, "contains": true,
+}
+
+// RelatedManga is one AniList relation of a series. MangaID and the cover
+// are only set when the related series is in the catalog; adaptations
+// usually aren't.
+type RelatedManga struct {
+	RelationType    string  `json:"relation_type"`
+	AniListID       int     `json:"anilist_id"`
+	MangaID         *int    `json:"manga_id"`
+	Type            *string `json:"type"`
+	Format          *string `json:"format"`
+	Title           *string `json:"title"`
+	CoverImageS3Key *string `json:"cover_image_s3_key"`
+}
+
+type RelationNode struct {
+	ID              int     `json:"id"`
+	TitleRomaji     *string `json:"title_romaji"`
+	TitleEnglish    *string `json:"title_english"`
+	TitleNative     *string `json:"title_native"`
+	CoverImageS3Key *string `json:"cover_image_s3_key"`
+	Depth           int     `json:"depth"`
+}
+
+type RelationEdge struct {
+	From         int    `json:"from"`
+	To           int    `json:"to"`
+	RelationType string `json:"relation_type"`
+}
+
+// loadRelations returns mangaID's relations, catalog series first.
+func loadRelations(ctx context.Context, conn *sql.DB, mangaID int) ([]RelatedManga, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT r.relation_type, r.related_anilist_id, m.id, r.related_type, r.related_format,
+		       COALESCE(m.title_english, m.title_romaji, r.related_title), m.cover_image_s3_key
+		FROM manga_relations r
+		LEFT JOIN manga m ON m.anilist_id = r.related_anilist_id
+		WHERE r.manga_id = $1
+		ORDER BY m.id IS NULL, r.relation_type, r.related_anilist_id`, mangaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relations := []RelatedManga{}
+	for rows.Next() {
+		var r RelatedManga
+		err := rows.Scan(&r.RelationType, &r.AniListID, &r.MangaID, &r.Type, &r.Format, &r.Title,
+			&r.CoverImageS3Key)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, r)
+	}
+	return relations, rows.Err()
+}
+
+// parseRelationTypes reads a comma-separated type filter. nil means every
+// type.
+func parseRelationTypes(raw string) ([]string, bool) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, true
+	}
+	var types []string
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if !relationTypes[t] {
+			return nil, false
+		}
+		types = append(types, t)
+	}
+	return types, true
+}
+
+// relation_graph walks relations breadth-first from a series, up to depth
+// hops and optionally only along some relation types. Only catalog series
+// are followed, so adaptations never appear here; manga_by_id lists them.
+func relation_graph(c *gin.Context) {
+	godotenv.Load()
+
+	mangaID, ok := pathID(c, "manga_id", "manga")
+	if !ok {
+		return
+	}
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", strconv.Itoa(defaultRelationDepth)))
+	if err != nil || depth < 1 || depth > maxRelationDepth {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("depth must be between 1 and %d", maxRelationDepth)})
+		return
+	}
+	types, ok := parseRelationTypes(c.Query("type"))
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid relation type"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer conn.Close()
+	ctx := c.Request.Context()
+
+	exists, err := mangaExists(ctx, conn, mangaID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	if !exists {
+		c.JSON(404, gin.H{"error": "Manga not found"})
+		return
+	}
+
+	depths := map[int]int{mangaID: 0}
+	order := []int{mangaID}
+	edges := []RelationEdge{}
+	frontier := []int{mangaID}
+	truncated := false
+
+	for level := 1; level <= depth && len(frontier) > 0 && !truncated; level++ {
+		rows, err := conn.QueryContext(ctx, `
+			SELECT r.manga_id, m.id, r.relation_type
+			FROM manga_relations r
+			JOIN manga m ON m.anilist_id = r.related_anilist_id
+			WHERE r.manga_id = ANY($1)
+			AND ($2::text[] IS NULL OR r.relation_type = ANY($2))
+			AND m.id <> r.manga_id
+			ORDER BY r.manga_id, r.relation_type, m.id`, pq.Array(frontier), pq.Array(types))
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(500, gin.H{"error": "Failed to query database"})
+			return
+		}
+
+		var next []int
+		for rows.Next() {
+			var e RelationEdge
+			if err := rows.Scan(&e.From, &e.To, &e.RelationType); err != nil {
+				rows.Close()
+				c.JSON(500, gin.H{"error": "Failed to scan row"})
+				return
+			}
+			if _, seen := depths[e.To]; !seen {
+				if len(order) >= maxRelationNodes {
+					truncated = true
+					continue
+				}
+				depths[e.To] = level
+				order = append(order, e.To)
+				next = append(next, e.To)
+			}
+			edges = append(edges, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to query database"})
+			return
+		}
+		frontier = next
+	}
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, title_romaji, title_english, title_native, cover_image_s3_key
+		FROM manga
+		WHERE id = ANY($1)
+		ORDER BY array_position($1, id)`, pq.Array(order))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+	defer rows.Close()
+
+	nodes := []RelationNode{}
+	for rows.Next() {
+		var n RelationNode
+		if err := rows.Scan(&n.ID, &n.TitleRomaji, &n.TitleEnglish, &n.TitleNative, &n.CoverImageS3Key); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		n.Depth = depths[n.ID]
+		nodes = append(nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to query database"})
+		return
+	}
+
+	c.JSON(200, gin.H{"root": mangaID, "nodes": nodes, "edges": edges, "truncated": truncated})
+}
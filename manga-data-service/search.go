@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchQueryLen  = 200
+
+	// ts_headline marks matches with these; they are swapped for <mark> once
+	// the snippet has been stripped of markup and escaped.
+	snippetStart = "⟦"
+	snippetStop  = "⟧"
+)
+
+var (
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+	isbnStripPattern = regexp.MustCompile(`[\s-]`)
+	isbnPattern      = regexp.MustCompile(`^(\d{13}|\d{9}[\dX])$`)
+
+	likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+)
+
+// A ranked search hit. Text is the display title; Snippet is HTML-escaped
+// with the matching part wrapped in <mark>.
+type SearchResult struct {
+	ID           int     `json:"id"`
+	MangaID      *int    `json:"manga_id,omitempty"`
+	Text         string  `json:"text"`
+	TitleEnglish *string `json:"title_english,omitempty"`
+	TitleRomaji  *string `json:"title_romaji,omitempty"`
+	TitleNative  *string `json:"title_native,omitempty"`
+	MangaTitle   *string `json:"manga_title,omitempty"`
+	VolumeNumber *int    `json:"volume_number,omitempty"`
+	CoverS3Key   *string `json:"cover_s3_key"`
+	Score        float64 `json:"score"`
+	MatchedField string  `json:"matched_field"`
+	Snippet      string  `json:"snippet"`
+}
+
+type searchParams struct {
+	Query string
+	By    string // manga, volume
+	// Limits results to the user's volumes with Status when UserID is set.
+	UserID int
+	Status string
+	Limit  int
+	Offset int
+}
+
+// Every branch yields (id, field, matched, score). Trigram matches use %
+// (similarity) and <% (word similarity) so typos still match, ILIKE catches
+// short substrings trigrams miss. Weights put exact ISBNs first and titles
+// ahead of descriptions, authors and publishers. $1 is the query, $2 the
+// normalized ISBN or an empty string, $7 the query as an ILIKE pattern.
+const mangaSearchHits = `
+	SELECT m.id, 'title_english' AS field, m.title_english AS matched,
+	       GREATEST(similarity(m.title_english, i.q), word_similarity(i.q, m.title_english)) AS score
+	FROM manga m, input i
+	WHERE m.title_english % i.q OR i.q <% m.title_english OR m.title_english ILIKE i.pattern
+	UNION ALL
+	SELECT m.id, 'title_romaji', m.title_romaji,
+	       GREATEST(similarity(m.title_romaji, i.q), word_similarity(i.q, m.title_romaji))
+	FROM manga m, input i
+	WHERE m.title_romaji % i.q OR i.q <% m.title_romaji OR m.title_romaji ILIKE i.pattern
+	UNION ALL
+	SELECT m.id, 'title_native', m.title_native,
+	       GREATEST(similarity(m.title_native, i.q), word_similarity(i.q, m.title_native))
+	FROM manga m, input i
+	WHERE m.title_native % i.q OR i.q <% m.title_native OR m.title_native ILIKE i.pattern
+	UNION ALL
+	SELECT m.id, 'description', NULL, 0.6 * ts_rank_cd(m.description_tsv, i.tsq, 32)
+	FROM manga m, input i
+	WHERE m.description_tsv @@ i.tsq
+	UNION ALL
+	SELECT m.id, 'author', a.name, 0.9 * word_similarity(i.q, a.name)
+	FROM manga m CROSS JOIN input i CROSS JOIN unnest(m.authors) AS a(name)
+	WHERE i.q <% a.name
+	UNION ALL
+	SELECT m.id, 'artist', a.name, 0.9 * word_similarity(i.q, a.name)
+	FROM manga m CROSS JOIN input i CROSS JOIN unnest(m.artists) AS a(name)
+	WHERE i.q <% a.name
+	UNION ALL
+	SELECT v.manga_id, 'isbn', COALESCE(v.isbn_13, v.isbn_10), 2.0
+	FROM volumes v
+	WHERE $2::text <> '' AND (v.isbn_13 = $2::text OR v.isbn_10 = $2::text)
+	UNION ALL
+	SELECT v.manga_id, 'publisher', v.publisher, 0.5 * word_similarity(i.q, v.publisher)
+	FROM volumes v, input i
+	WHERE i.q <% v.publisher`
+
+const volumeSearchHits = `
+	SELECT v.id, 'title' AS field, v.title AS matched,
+	       GREATEST(similarity(v.title, i.q), word_similarity(i.q, v.title)) AS score
+	FROM volumes v, input i
+	WHERE v.title % i.q OR i.q <% v.title OR v.title ILIKE i.pattern
+	UNION ALL
+	SELECT v.id, 'subtitle', v.subtitle, 0.8 * word_similarity(i.q, v.subtitle)
+	FROM volumes v, input i
+	WHERE i.q <% v.subtitle
+	UNION ALL
+	SELECT v.id, 'manga_title', t.title, 0.8 * GREATEST(similarity(t.title, i.q), word_similarity(i.q, t.title))
+	FROM manga m
+	CROSS JOIN input i
+	CROSS JOIN LATERAL (VALUES (m.title_english), (m.title_romaji), (m.title_native)) AS t(title)
+	JOIN volumes v ON v.manga_id = m.id
+	WHERE t.title % i.q OR i.q <% t.title OR t.title ILIKE i.pattern
+	UNION ALL
+	SELECT v.id, 'description', NULL, 0.6 * ts_rank_cd(v.description_tsv, i.tsq, 32)
+	FROM volumes v, input i
+	WHERE v.description_tsv @@ i.tsq
+	UNION ALL
+	SELECT v.id, 'isbn', COALESCE(v.isbn_13, v.isbn_10), 2.0
+	FROM volumes v
+	WHERE $2::text <> '' AND (v.isbn_13 = $2::text OR v.isbn_10 = $2::text)
+	UNION ALL
+	SELECT v.id, 'publisher', v.publisher, 0.5 * word_similarity(i.q, v.publisher)
+	FROM volumes v, input i
+	WHERE i.q <% v.publisher`
+
+// rankedSearchSQL combines the hits of one kind: an item scores its best
+// match plus a little for every other field that matched. $3/$4 scope it to
+// a user's collection or wishlist, $5/$6 page it. Snippets are built for
+// the returned page only.
+func rankedSearchSQL(hits string, selectCols string, from string, scope string, order string) string {
+	return `
+	WITH input AS (
+		SELECT $1::text AS q, websearch_to_tsquery('english', $1::text) AS tsq, $7::text AS pattern
+	),
+	hits AS (` + hits + `
+	),
+	ranked AS (
+		SELECT id,
+		       MAX(score) + 0.05 * (COUNT(DISTINCT field) - 1) AS score,
+		       (array_agg(field ORDER BY score DESC))[1] AS field,
+		       (array_agg(matched ORDER BY score DESC))[1] AS matched
+		FROM hits
+		GROUP BY id
+	),
+	page AS (
+		SELECT ` + selectCols + `, r.score, r.field, r.matched,
+		       row_number() OVER (ORDER BY r.score DESC, ` + order + `) AS position
+		FROM ranked r
+		` + from + `
+		WHERE ($3::int = 0 OR EXISTS (` + scope + `))
+		ORDER BY position
+		LIMIT $5 OFFSET $6
+	)
+	SELECT page.*,
+	       CASE WHEN page.field = 'description' THEN ts_headline('english', page.description, i.tsq,
+	           'StartSel=` + snippetStart + `, StopSel=` + snippetStop + `, MaxWords=25, MinWords=10, MaxFragments=2, FragmentDelimiter=" … "')
+	       END
+	FROM page, input i
+	ORDER BY page.position
+	`
+}
+
+var mangaSearchSQL = rankedSearchSQL(mangaSearchHits,
+	`m.id, COALESCE(m.title_english, m.title_romaji, m.title_native, '') AS text, m.title_english, m.title_romaji,
+		        m.title_native, m.cover_image_s3_key, m.popularity, m.description`,
+	`JOIN manga m ON m.id = r.id`,
+	`SELECT 1 FROM user_manga um JOIN volumes uv ON uv.id = um.manga_volume_id
+		WHERE um.user_id = $3 AND um.status = $4 AND uv.manga_id = m.id`,
+	`m.popularity DESC NULLS LAST, m.id`)
+
+var volumeSearchSQL = rankedSearchSQL(volumeSearchHits,
+	`v.id, v.manga_id, COALESCE(v.title, '') AS text, COALESCE(m.title_english, m.title_romaji, m.title_native) AS manga_title,
+		        v.volume_number, v.thumbnail_s3_key, m.popularity, v.description`,
+	`JOIN volumes v ON v.id = r.id JOIN manga m ON m.id = v.manga_id`,
+	`SELECT 1 FROM user_manga um WHERE um.user_id = $3 AND um.status = $4 AND um.manga_volume_id = v.id`,
+	`m.popularity DESC NULLS LAST, m.id, v.volume_number NULLS LAST, v.id`)
+
+// normalizeISBN returns the query as a bare ISBN-10/13, or "" if it isn't one.
+func normalizeISBN(q string) string {
+	s := strings.ToUpper(isbnStripPattern.ReplaceAllString(q, ""))
+	if isbnPattern.MatchString(s) {
+		return s
+	}
+	return ""
+}
+
+// likeContains escapes LIKE wildcards in q and wraps it in %, so the query
+// is matched literally as a substring.
+func likeContains(q string) string {
+	return "%" + likeEscaper.Replace(q) + "%"
+}
+
+// highlightTitle escapes text and marks the first match of the query, as
+// compiled by runSearch. Fuzzy matches have no exact occurrence and are left
+// unmarked.
+func highlightTitle(text string, match *regexp.Regexp) string {
+	loc := match.FindStringIndex(text)
+	if loc == nil {
+		return html.EscapeString(text)
+	}
+	return html.EscapeString(text[:loc[0]]) + "<mark>" + html.EscapeString(text[loc[0]:loc[1]]) +
+		"</mark>" + html.EscapeString(text[loc[1]:])
+}
+
+// cleanHeadline turns a ts_headline fragment of a description, which may
+// contain AniList's HTML, into escaped text with <mark> highlights.
+func cleanHeadline(s string) string {
+	s = htmlTagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = strings.Join(strings.Fields(s), " ")
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, snippetStart, "<mark>")
+	return strings.ReplaceAll(s, snippetStop, "</mark>")
+}
+
+// runSearch returns one page of ranked results and whether more follow.
+func runSearch(ctx context.Context, conn *sql.DB, p searchParams) ([]SearchResult, bool, error) {
+	query := mangaSearchSQL
+	if p.By == "volume" {
+		query = volumeSearchSQL
+	}
+
+	rows, err := conn.QueryContext(ctx, query,
+		p.Query, normalizeISBN(p.Query), p.UserID, p.Status, p.Limit+1, p.Offset, likeContains(p.Query))
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	match := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(p.Query))
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		var popularity sql.NullInt64
+		var position int
+		var description, matched, headline sql.NullString
+		var err error
+		if p.By == "volume" {
+			var mangaID int
+			err = rows.Scan(&r.ID, &mangaID, &r.Text, &r.MangaTitle, &r.VolumeNumber, &r.CoverS3Key,
+				&popularity, &description, &r.Score, &r.MatchedField, &matched, &position, &headline)
+			r.MangaID = &mangaID
+		} else {
+			err = rows.Scan(&r.ID, &r.Text, &r.TitleEnglish, &r.TitleRomaji, &r.TitleNative, &r.CoverS3Key,
+				&popularity, &description, &r.Score, &r.MatchedField, &matched, &position, &headline)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch {
+		case headline.Valid:
+			r.Snippet = cleanHeadline(headline.String)
+		case matched.Valid:
+			r.Snippet = highlightTitle(matched.String, match)
+		default:
+			r.Snippet = highlightTitle(r.Text, match)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(results) > p.Limit
+	if hasMore {
+		results = results[:p.Limit]
+	}
+	return results, hasMore, nil
+}
+
+// Where a search looks. Anything other than general needs the login cookie.
+type searchScope string
+
+const (
+	scopeGeneral    searchScope = "general"    // the whole catalog
+	scopeCollected  searchScope = "collected"  // the caller's collection
+	scopeWishlisted searchScope = "wishlisted" // the caller's wishlist
+)
+
+// parseSearchScope validates a scope. The deprecated POST /search was
+// documented with "collection" and "wishlist", so those are accepted too.
+func parseSearchScope(s string) (searchScope, bool) {
+	switch s {
+	case "", "general":
+		return scopeGeneral, true
+	case "collected", "collection":
+		return scopeCollected, true
+	case "wishlisted", "wishlist":
+		return scopeWishlisted, true
+	}
+	return "", false
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	By      string         `json:"by"`
+	Scope   searchScope    `json:"scope"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	HasMore bool           `json:"hasMore"`
+}
+
+// executeSearch validates a request shared by both search routes, resolves
+// the caller for personal scopes and runs it. It writes the error response
+// itself and returns false when the request can't be served.
+func executeSearch(c *gin.Context, query string, by string, scope searchScope, limit int, offset int) (SearchResponse, bool) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		c.JSON(400, gin.H{"error": "Missing search query"})
+		return SearchResponse{}, false
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLen {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Search query can't be longer than %d characters", maxSearchQueryLen)})
+		return SearchResponse{}, false
+	}
+	if by != "manga" && by != "volume" {
+		c.JSON(400, gin.H{"error": "by must be manga or volume"})
+		return SearchResponse{}, false
+	}
+
+	params := searchParams{Query: query, By: by, Limit: limit, Offset: offset}
+	if scope != scopeGeneral {
+		userID, ok := getUserIDFromCookie(c)
+		if !ok {
+			return SearchResponse{}, false
+		}
+		params.UserID = userID
+		params.Status = string(scope)
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Server error"})
+		return SearchResponse{}, false
+	}
+	defer conn.Close()
+
+	results, hasMore, err := runSearch(c.Request.Context(), conn, params)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to query"})
+		return SearchResponse{}, false
+	}
+
+	return SearchResponse{
+		Results: results,
+		By:      by,
+		Scope:   scope,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: hasMore,
+	}, true
+}
+
+// searchV1 is GET /v1/search. Parameters:
+//   - q: the search text, required
+//   - by: manga (default) or volume
+//   - scope: general (default), collected or wishlisted
+//   - limit: 1 to 50, default 20; offset: default 0
+func searchV1(c *gin.Context) {
+	godotenv.Load()
+
+	scope, ok := parseSearchScope(c.Query("scope"))
+	if !ok {
+		c.JSON(400, gin.H{"error": "scope must be general, collected or wishlisted"})
+		return
+	}
+
+	limit, offset, ok := pageParams(c, defaultSearchLimit, maxSearchLimit)
+	if !ok {
+		return
+	}
+
+	response, ok := executeSearch(c, c.Query("q"), c.DefaultQuery("by", "manga"), scope, limit, offset)
+	if !ok {
+		return
+	}
+	c.JSON(200, response)
+}
+
+// search is the original POST /search, kept for older clients. It takes
+// ?query= plus a JSON body of searchFrom (general, collected, wishlisted)
+// and by (manga, volume).
+//
+// Deprecated: use GET /v1/search.
+func search(c *gin.Context) {
+	godotenv.Load()
+	c.Header("Deprecation", "true")
+	c.Header("Link", `</mangas/v1/search>; rel="successor-version"`)
+
+	type SearchBody struct {
+		SearchFrom string `json:"searchFrom"`
+		By         string `json:"by"`
+	}
+
+	var searchBody SearchBody
+	if err := c.ShouldBindJSON(&searchBody); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+
+	scope, ok := parseSearchScope(searchBody.SearchFrom)
+	if !ok {
+		c.JSON(400, gin.H{"error": "searchFrom must be general, collected or wishlisted"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	response, ok := executeSearch(c, c.Query("query"), searchBody.By, scope, limit, offset)
+	if !ok {
+		return
+	}
+
+	type LegacySearchResponse struct {
+		Results    []SearchResult `json:"results"`
+		By         string         `json:"by"`
+		SearchFrom searchScope    `json:"searchFrom"`
+		HasMore    bool           `json:"hasMore"`
+	}
+
+	c.JSON(200, LegacySearchResponse{
+		Results:    response.Results,
+		By:         response.By,
+		SearchFrom: response.Scope,
+		HasMore:    response.HasMore,
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// The volume endpoints used to join every collector's user_manga row, so a
+// volume showed up once per collector with someone else's status.
+
+type volumeStatus struct {
+	VolumeID      int `json:"volume_id"`
+	UserColStatus struct {
+		String string
+		Valid  bool
+	} `json:"user_col_status"`
+}
+
+func (v volumeStatus) status() string {
+	if !v.UserColStatus.Valid {
+		return "NULL"
+	}
+	return v.UserColStatus.String
+}
+
+func decodeVolumeList(t *testing.T, body []byte) []volumeStatus {
+	t.Helper()
+	var page struct {
+		Volumes []volumeStatus `json:"volumes"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return page.Volumes
+}
+
+func TestVolumeStatusIsTheCallers(t *testing.T) {
+	conn := newTestDB(t)
+	router := newRouter()
+
+	alice := seedUser(t, conn, "status_alice")
+	bob := seedUser(t, conn, "status_bob")
+	carol := seedUser(t, conn, "status_carol")
+	mangaID := seedManga(t, conn, "Status Test")
+	first := seedVolume(t, conn, mangaID, 1)
+	second := seedVolume(t, conn, mangaID, 2)
+	seedStatus(t, conn, alice, first, "collected")
+	seedStatus(t, conn, bob, first, "wishlisted")
+	seedStatus(t, conn, bob, second, "collected")
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   map[int]string
+	}{
+		{"alice", authCookie(t, alice), map[int]string{first: "collected", second: "NULL"}},
+		{"bob", authCookie(t, bob), map[int]string{first: "wishlisted", second: "collected"}},
+		{"signed in without statuses", authCookie(t, carol), map[int]string{first: "NULL", second: "NULL"}},
+		{"anonymous", nil, map[int]string{first: "NULL", second: "NULL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, fmt.Sprintf("/%d/volumes", mangaID), tt.cookie)
+			if w.Code != 200 {
+				t.Fatalf("list: status %d: %s", w.Code, w.Body)
+			}
+			volumes := decodeVolumeList(t, w.Body.Bytes())
+			if len(volumes) != len(tt.want) {
+				t.Fatalf("list: got %d volumes, want %d (one per volume, not per collector)", len(volumes), len(tt.want))
+			}
+			seen := map[int]bool{}
+			for _, v := range volumes {
+				if seen[v.VolumeID] {
+					t.Errorf("list: volume %d listed twice", v.VolumeID)
+				}
+				seen[v.VolumeID] = true
+				if got := v.status(); got != tt.want[v.VolumeID] {
+					t.Errorf("list: volume %d status %s, want %s", v.VolumeID, got, tt.want[v.VolumeID])
+				}
+			}
+
+			for volumeID, want := range tt.want {
+				w := serve(router, fmt.Sprintf("/%d/volumes/%d", mangaID, volumeID), tt.cookie)
+				if w.Code != 200 {
+					t.Fatalf("volume %d: status %d: %s", volumeID, w.Code, w.Body)
+				}
+				var v volumeStatus
+				if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+					t.Fatal(err)
+				}
+				if got := v.status(); got != want {
+					t.Errorf("volume %d: status %s, want %s", volumeID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVolumeStatusNotSharedThroughCache(t *testing.T) {
+	conn := newTestDB(t)
+	withCatalogCache(t)
+	router := newRouter()
+
+	collector := seedUser(t, conn, "cache_collector")
+	mangaID := seedManga(t, conn, "Cache Test")
+	volumeID := seedVolume(t, conn, mangaID, 1)
+	seedStatus(t, conn, collector, volumeID, "collected")
+	cookie := authCookie(t, collector)
+
+	listStatus := func(t *testing.T, path string, cookie *http.Cookie) (string, http.Header) {
+		t.Helper()
+		w := serve(router, path, cookie)
+		if w.Code != 200 {
+			t.Fatalf("%s: status %d: %s", path, w.Code, w.Body)
+		}
+		volumes := decodeVolumeList(t, w.Body.Bytes())
+		if len(volumes) != 1 {
+			t.Fatalf("%s: got %d volumes, want 1", path, len(volumes))
+		}
+		return volumes[0].status(), w.Header()
+	}
+
+	t.Run("anonymous first", func(t *testing.T) {
+		path := fmt.Sprintf("/%d/volumes", mangaID)
+		status, header := listStatus(t, path, nil)
+		if status != "NULL" || header.Get("Cache-Control") != "public, max-age=300" {
+			t.Fatalf("anonymous: status %s, Cache-Control %q", status, header.Get("Cache-Control"))
+		}
+
+		// The anonymous entry is now cached; the collector must not get it.
+		status, header = listStatus(t, path, cookie)
+		if status != "collected" {
+			t.Errorf("signed in after a cached anonymous response: status %s, want collected", status)
+		}
+		if header.Get("Cache-Control") != "private, no-cache" || header.Get("Vary") != "Cookie" {
+			t.Errorf("signed in: Cache-Control %q, Vary %q", header.Get("Cache-Control"), header.Get("Vary"))
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(cookie)
+		req.Header.Set("If-None-Match", "*")
+		if w := serveRequest(router, req); w.Code != 200 {
+			t.Errorf("signed in with If-None-Match: status %d, want 200", w.Code)
+		}
+	})
+
+	t.Run("signed in first", func(t *testing.T) {
+		path := fmt.Sprintf("/%d/volumes?limit=5", mangaID)
+		if status, _ := listStatus(t, path, cookie); status != "collected" {
+			t.Fatalf("signed in: status %s, want collected", status)
+		}
+		if status, _ := listStatus(t, path, nil); status != "NULL" {
+			t.Errorf("anonymous after a signed-in response: status %s, want NULL", status)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+-- Collection value and spending statistics (user-service GET /stats).
+
+-- Locally maintained exchange rates. rate_to_base is the value of one unit of
+-- `currency` expressed in the reporting currency (BASE_CURRENCY, default USD).
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency     CHAR(3) PRIMARY KEY,
+    rate_to_base NUMERIC(18, 8) NOT NULL CHECK (rate_to_base > 0),
+    updated_at   TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO exchange_rates (currency, rate_to_base)
+VALUES ('USD', 1)
+ON CONFLICT (currency) DO NOTHING;
+
+-- What the user actually paid for a collected volume, when they record it.
+ALTER TABLE user_manga
+    ADD COLUMN IF NOT EXISTS purchase_price NUMERIC(10, 2),
+    ADD COLUMN IF NOT EXISTS purchase_currency CHAR(3);
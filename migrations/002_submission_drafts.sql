@@ -0,0 +1,15 @@
+-- Barcodes scanned in user-service that matched no volume. A draft keeps the
+-- ISBN around until the user turns it into a real submission.
+CREATE TABLE IF NOT EXISTS submission_drafts (
+    id              SERIAL PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    isbn_13         VARCHAR(13) NOT NULL,
+    isbn_10         VARCHAR(10),
+    intended_status VARCHAR(20) NOT NULL DEFAULT 'collected',
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, isbn_13)
+);
+
+-- Submissions created from a draft carry its ISBN onto the approved volume.
+ALTER TABLE manga_volume_submissions
+    ADD COLUMN IF NOT EXISTS isbn_13 VARCHAR(13);
@@ -0,0 +1,24 @@
+-- Append-only log of every change to user_manga. Each row stores the full
+-- user_manga row before and after the change so any change can be undone.
+-- Changes made by one request share a batch_id; undoing a change appends a
+-- new event pointing back at it through reverts_event_id.
+CREATE TABLE IF NOT EXISTS user_manga_events (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    manga_volume_id  INTEGER NOT NULL REFERENCES volumes(id) ON DELETE CASCADE,
+    batch_id         VARCHAR(32) NOT NULL,
+    source           VARCHAR(40) NOT NULL,
+    action           VARCHAR(10) NOT NULL CHECK (action IN ('added', 'updated', 'removed')),
+    old_status       VARCHAR(20),
+    new_status       VARCHAR(20),
+    old_added_at     TIMESTAMP,
+    new_added_at     TIMESTAMP,
+    old_row          JSONB,
+    new_row          JSONB,
+    reverts_event_id BIGINT REFERENCES user_manga_events(id),
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS user_manga_events_user_idx ON user_manga_events (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS user_manga_events_batch_idx ON user_manga_events (batch_id);
+CREATE INDEX IF NOT EXISTS user_manga_events_reverts_idx ON user_manga_events (reverts_event_id);
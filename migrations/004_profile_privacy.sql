@@ -0,0 +1,24 @@
+-- Who may see a user's profile, collection and wishlist. Users without a row
+-- are public. The collection and wishlist settings only apply to viewers
+-- who can see the profile at all.
+CREATE TABLE IF NOT EXISTS user_privacy_settings (
+    user_id               INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    profile_visibility    VARCHAR(10) NOT NULL DEFAULT 'public'
+        CHECK (profile_visibility IN ('public', 'followers', 'private')),
+    collection_visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+        CHECK (collection_visibility IN ('public', 'followers', 'private')),
+    wishlist_visibility   VARCHAR(10) NOT NULL DEFAULT 'public'
+        CHECK (wishlist_visibility IN ('public', 'followers', 'private')),
+    updated_at            TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Follow graph, used for followers-only visibility.
+CREATE TABLE IF NOT EXISTS user_follows (
+    follower_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_follows_followee_idx ON user_follows (followee_id);
@@ -0,0 +1,30 @@
+-- Activity feed. Rows are derived from user_manga_events when a collection
+-- change is committed (one collection_add per series per batch, plus a
+-- series_completed when the batch finished a series) and written by
+-- submission-service when a submission is approved.
+CREATE TABLE IF NOT EXISTS activity_events (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type    VARCHAR(30) NOT NULL CHECK (event_type IN ('collection_add', 'series_completed', 'submission_approved')),
+    manga_id      INTEGER REFERENCES manga(id) ON DELETE CASCADE,
+    volume_ids    INTEGER[] NOT NULL DEFAULT '{}',
+    batch_id      VARCHAR(32),
+    submission_id INTEGER,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS activity_events_user_idx ON activity_events (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS activity_events_batch_idx ON activity_events (batch_id);
+
+-- Event types a user has hidden from their feed.
+CREATE TABLE IF NOT EXISTS feed_mutes (
+    user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(30) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, event_type)
+);
+
+-- Following needs the followee's approval unless their profile is public and
+-- nothing is followers-only.
+-- Pending follows do not count for followers-only visibility.
+ALTER TABLE user_follows ADD COLUMN IF NOT EXISTS approved BOOLEAN NOT NULL DEFAULT TRUE;
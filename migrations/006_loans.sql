@@ -0,0 +1,33 @@
+-- Loans and trades between users. A loan lends the proposer's volumes to the
+-- recipient until the proposer confirms they came back. A trade swaps the
+-- proposer's volumes for the recipient's when it is accepted.
+CREATE TABLE IF NOT EXISTS loans (
+    id               SERIAL PRIMARY KEY,
+    kind             VARCHAR(10) NOT NULL CHECK (kind IN ('loan', 'trade')),
+    proposer_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status           VARCHAR(10) NOT NULL DEFAULT 'proposed'
+                     CHECK (status IN ('proposed', 'accepted', 'declined', 'cancelled', 'returned', 'completed')),
+    due_date         DATE,
+    note             TEXT,
+    reminder_count   INTEGER NOT NULL DEFAULT 0,
+    last_reminded_at TIMESTAMP,
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+    responded_at     TIMESTAMP,
+    returned_at      TIMESTAMP,
+    CHECK (proposer_id <> recipient_id)
+);
+
+CREATE INDEX IF NOT EXISTS loans_proposer_idx ON loans (proposer_id, status);
+CREATE INDEX IF NOT EXISTS loans_recipient_idx ON loans (recipient_id, status);
+
+-- owner_id is whoever holds the volume when the loan is proposed: always the
+-- proposer for loans, either side for trades.
+CREATE TABLE IF NOT EXISTS loan_items (
+    loan_id         INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    owner_id        INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    manga_volume_id INTEGER NOT NULL REFERENCES volumes(id) ON DELETE CASCADE,
+    PRIMARY KEY (loan_id, manga_volume_id)
+);
+
+CREATE INDEX IF NOT EXISTS loan_items_owner_idx ON loan_items (owner_id, manga_volume_id);
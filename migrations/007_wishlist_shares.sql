@@ -0,0 +1,21 @@
+-- Public wishlist links. A user has at most one link; rotating it replaces
+-- the token, revoking it sets revoked_at.
+CREATE TABLE IF NOT EXISTS wishlist_shares (
+    user_id    INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token      VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+-- Anonymous "I'll buy this" claims made through a share link. They are never
+-- shown to the wishlist owner. claim_token lets the visitor withdraw it.
+CREATE TABLE IF NOT EXISTS gift_claims (
+    id              SERIAL PRIMARY KEY,
+    owner_id        INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    manga_volume_id INTEGER NOT NULL REFERENCES volumes(id) ON DELETE CASCADE,
+    claim_token     VARCHAR(64) NOT NULL,
+    claimer_name    VARCHAR(100),
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (owner_id, manga_volume_id)
+);
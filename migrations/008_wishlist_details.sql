@@ -0,0 +1,28 @@
+-- Per-item wishlist details. Priority runs from 1 (must have) to 5 (someday).
+-- wishlist_position is the user's manual order; unordered items sort last.
+ALTER TABLE user_manga
+    ADD COLUMN IF NOT EXISTS wishlist_priority SMALLINT CHECK (wishlist_priority BETWEEN 1 AND 5),
+    ADD COLUMN IF NOT EXISTS wishlist_max_price NUMERIC(10, 2) CHECK (wishlist_max_price >= 0),
+    ADD COLUMN IF NOT EXISTS wishlist_max_price_currency CHAR(3),
+    ADD COLUMN IF NOT EXISTS wishlist_note TEXT,
+    ADD COLUMN IF NOT EXISTS wishlist_position INTEGER;
+
+-- The details only mean something on the wishlist. They are cleared whenever
+-- a row leaves it, however that happens, so wishlisting the volume again
+-- starts fresh instead of bringing back stale values.
+CREATE OR REPLACE FUNCTION clear_wishlist_details() RETURNS trigger AS $$
+BEGIN
+    NEW.wishlist_priority := NULL;
+    NEW.wishlist_max_price := NULL;
+    NEW.wishlist_max_price_currency := NULL;
+    NEW.wishlist_note := NULL;
+    NEW.wishlist_position := NULL;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS user_manga_clear_wishlist_details ON user_manga;
+CREATE TRIGGER user_manga_clear_wishlist_details
+    BEFORE UPDATE OF status ON user_manga
+    FOR EACH ROW WHEN (OLD.status = 'wishlisted' AND NEW.status <> 'wishlisted')
+    EXECUTE FUNCTION clear_wishlist_details();
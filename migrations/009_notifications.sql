@@ -0,0 +1,77 @@
+-- Queue of volume changes for user-service's notification worker. Triggers
+-- fill it so every writer (the scraper, submission approvals) is covered.
+CREATE TABLE IF NOT EXISTS volume_changes (
+    id                 BIGSERIAL PRIMARY KEY,
+    volume_id          INTEGER NOT NULL REFERENCES volumes(id) ON DELETE CASCADE,
+    change             VARCHAR(20) NOT NULL CHECK (change IN ('inserted', 'price_changed')),
+    old_price_amount   NUMERIC,
+    old_price_currency VARCHAR(10),
+    new_price_amount   NUMERIC,
+    new_price_currency VARCHAR(10),
+    created_at         TIMESTAMP NOT NULL DEFAULT NOW(),
+    processed_at       TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS volume_changes_pending_idx ON volume_changes (id) WHERE processed_at IS NULL;
+
+CREATE OR REPLACE FUNCTION queue_volume_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO volume_changes (volume_id, change, new_price_amount, new_price_currency)
+        VALUES (NEW.id, 'inserted', NEW.price_amount, NEW.price_currency);
+    ELSIF NEW.price_amount IS DISTINCT FROM OLD.price_amount
+       OR NEW.price_currency IS DISTINCT FROM OLD.price_currency THEN
+        INSERT INTO volume_changes (volume_id, change, old_price_amount, old_price_currency,
+                                    new_price_amount, new_price_currency)
+        VALUES (NEW.id, 'price_changed', OLD.price_amount, OLD.price_currency,
+                NEW.price_amount, NEW.price_currency);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS volumes_queue_change ON volumes;
+CREATE TRIGGER volumes_queue_change
+    AFTER INSERT OR UPDATE OF price_amount, price_currency ON volumes
+    FOR EACH ROW EXECUTE FUNCTION queue_volume_change();
+
+-- Series a user explicitly follows. Series they collect are followed
+-- implicitly unless follow_collected_series is turned off.
+CREATE TABLE IF NOT EXISTS series_follows (
+    user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    manga_id   INTEGER NOT NULL REFERENCES manga(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, manga_id)
+);
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id                 INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    new_volumes             BOOLEAN NOT NULL DEFAULT TRUE,
+    upcoming_releases       BOOLEAN NOT NULL DEFAULT TRUE,
+    price_drops             BOOLEAN NOT NULL DEFAULT TRUE,
+    loan_reminders          BOOLEAN NOT NULL DEFAULT TRUE,
+    follow_collected_series BOOLEAN NOT NULL DEFAULT TRUE,
+    upcoming_days           SMALLINT NOT NULL DEFAULT 7 CHECK (upcoming_days BETWEEN 1 AND 60),
+    email_digest            VARCHAR(10) NOT NULL DEFAULT 'none' CHECK (email_digest IN ('none', 'daily', 'weekly')),
+    last_digest_at          TIMESTAMP,
+    updated_at              TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- dedupe_key makes generating a notification idempotent, so the worker can
+-- rerun safely.
+CREATE TABLE IF NOT EXISTS notifications (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type       VARCHAR(30) NOT NULL CHECK (type IN ('new_volume', 'upcoming_release', 'price_drop', 'loan_reminder')),
+    manga_id   INTEGER REFERENCES manga(id) ON DELETE CASCADE,
+    volume_id  INTEGER REFERENCES volumes(id) ON DELETE CASCADE,
+    data       JSONB NOT NULL DEFAULT '{}',
+    dedupe_key VARCHAR(100) NOT NULL,
+    read_at    TIMESTAMP,
+    emailed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,10 @@
+-- Private iCalendar feed links. The token in the URL is the only credential,
+-- since calendar apps can't send the login cookie. Rotating it replaces the
+-- token, deleting the row turns the feed off.
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id    INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token      VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS volumes_published_date_idx ON volumes (published_date);
@@ -0,0 +1,32 @@
+-- Materialized by manga-data-service's recommendation job ("manga-data-service
+-- recommend"). Both tables are rebuilt wholesale on every run.
+
+-- Top similar series per series. score blends how often the two are
+-- collected together (co_owner_score, cosine over collectors) with how many
+-- genres and tags they share (content_score, Jaccard).
+CREATE TABLE IF NOT EXISTS manga_similarity (
+    manga_id         INTEGER NOT NULL REFERENCES manga(id) ON DELETE CASCADE,
+    similar_manga_id INTEGER NOT NULL REFERENCES manga(id) ON DELETE CASCADE,
+    score            DOUBLE PRECISION NOT NULL,
+    co_owner_score   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    content_score    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    co_owners        INTEGER NOT NULL DEFAULT 0,
+    computed_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (manga_id, similar_manga_id)
+);
+
+CREATE INDEX IF NOT EXISTS manga_similarity_rank_idx ON manga_similarity (manga_id, score DESC);
+
+-- Suggested series per user, never including one they had collected when
+-- the job ran. because_manga_ids are the collected series that contributed
+-- most, best first.
+CREATE TABLE IF NOT EXISTS user_recommendations (
+    user_id           INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    manga_id          INTEGER NOT NULL REFERENCES manga(id) ON DELETE CASCADE,
+    score             DOUBLE PRECISION NOT NULL,
+    because_manga_ids INTEGER[] NOT NULL DEFAULT '{}',
+    computed_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, manga_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_recommendations_rank_idx ON user_recommendations (user_id, score DESC);
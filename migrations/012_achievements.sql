@@ -0,0 +1,41 @@
+-- The catalogue of achievements, read by user-service (collection badges and
+-- progress) and submission-service (approval badges). A badge is earned once
+-- its metric reaches goal; user-service knows how to compute each metric.
+-- Keys are stored in user_achievements, so never rename one.
+CREATE TABLE IF NOT EXISTS achievements (
+    key         VARCHAR(50) PRIMARY KEY,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL,
+    metric      VARCHAR(30) NOT NULL
+                CHECK (metric IN ('volumes', 'series', 'completed_series', 'publishers', 'approved_submissions')),
+    goal        INTEGER NOT NULL CHECK (goal > 0),
+    -- Display order.
+    position    INTEGER NOT NULL
+);
+
+INSERT INTO achievements (key, name, description, metric, goal, position) VALUES
+    ('first_volume', 'First Volume', 'Add your first volume to your collection', 'volumes', 1, 1),
+    ('volumes_50', 'Bookshelf', 'Own 50 volumes', 'volumes', 50, 2),
+    ('volumes_100', 'Century', 'Own 100 volumes', 'volumes', 100, 3),
+    ('volumes_500', 'Library', 'Own 500 volumes', 'volumes', 500, 4),
+    ('series_10', 'Explorer', 'Collect volumes from 10 different series', 'series', 10, 5),
+    ('first_series_completed', 'Completionist', 'Complete your first series', 'completed_series', 1, 6),
+    ('series_completed_10', 'Master Completionist', 'Complete 10 series', 'completed_series', 10, 7),
+    ('publishers_10', 'Well Read', 'Own volumes from 10 different publishers', 'publishers', 10, 8),
+    ('first_submission_approved', 'Contributor', 'Have your first submission approved', 'approved_submissions', 1, 9),
+    ('submissions_approved_10', 'Archivist', 'Have 10 submissions approved', 'approved_submissions', 10, 10)
+ON CONFLICT (key) DO UPDATE SET
+    name = EXCLUDED.name,
+    description = EXCLUDED.description,
+    metric = EXCLUDED.metric,
+    goal = EXCLUDED.goal,
+    position = EXCLUDED.position;
+
+-- Badges a user has earned. A row only records when an achievement was first
+-- reached; badges are kept even if the collection later shrinks.
+CREATE TABLE IF NOT EXISTS user_achievements (
+    user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    achievement VARCHAR(50) NOT NULL REFERENCES achievements(key),
+    awarded_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, achievement)
+);
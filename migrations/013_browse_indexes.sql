@@ -0,0 +1,10 @@
+-- Indexes for catalog browsing (get_mangas). The sort indexes match the
+-- COALESCE expressions in browseSorts so keyset pages can seek directly.
+CREATE INDEX IF NOT EXISTS manga_genres_idx ON manga USING GIN (genres);
+CREATE INDEX IF NOT EXISTS manga_tags_idx ON manga USING GIN (tags);
+
+CREATE INDEX IF NOT EXISTS manga_browse_popularity_idx ON manga ((COALESCE(popularity, -1)), id);
+CREATE INDEX IF NOT EXISTS manga_browse_score_idx ON manga ((COALESCE(average_score, -1)), id);
+CREATE INDEX IF NOT EXISTS manga_browse_title_idx ON manga ((lower(COALESCE(title_english, title_romaji, title_native, ''))), id);
+CREATE INDEX IF NOT EXISTS manga_browse_start_date_idx ON manga ((COALESCE(start_date, DATE '0001-01-01')), id);
+CREATE INDEX IF NOT EXISTS manga_browse_volumes_idx ON manga ((COALESCE(total_volumes, -1)), id);
@@ -0,0 +1,21 @@
+-- Ranked catalog search (manga-data-service search.go): trigram indexes for
+-- fuzzy title, author and publisher matches, full-text vectors for
+-- descriptions and plain indexes for exact ISBN lookups.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE manga ADD COLUMN IF NOT EXISTS description_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', COALESCE(description, ''))) STORED;
+ALTER TABLE volumes ADD COLUMN IF NOT EXISTS description_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', COALESCE(description, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS manga_description_tsv_idx ON manga USING GIN (description_tsv);
+CREATE INDEX IF NOT EXISTS volumes_description_tsv_idx ON volumes USING GIN (description_tsv);
+
+CREATE INDEX IF NOT EXISTS manga_title_english_trgm_idx ON manga USING GIN (title_english gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS manga_title_romaji_trgm_idx ON manga USING GIN (title_romaji gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS manga_title_native_trgm_idx ON manga USING GIN (title_native gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS volumes_title_trgm_idx ON volumes USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS volumes_publisher_trgm_idx ON volumes USING GIN (publisher gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS volumes_isbn_13_idx ON volumes (isbn_13);
+CREATE INDEX IF NOT EXISTS volumes_isbn_10_idx ON volumes (isbn_10);
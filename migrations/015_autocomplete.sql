@@ -0,0 +1,7 @@
+-- Prefix lookups for autocomplete. text_pattern_ops lets LIKE 'abc%' use the
+-- index whatever the database collation; fuzzy matches use the trigram
+-- indexes from 014_search.sql.
+CREATE INDEX IF NOT EXISTS manga_title_english_prefix_idx ON manga (lower(title_english) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS manga_title_romaji_prefix_idx ON manga (lower(title_romaji) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS manga_title_native_prefix_idx ON manga (lower(title_native) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS volumes_title_prefix_idx ON volumes (lower(title) text_pattern_ops);
@@ -0,0 +1,157 @@
+-- Normalized authors, artists and publishers. manga.authors, manga.artists
+-- and volumes.publisher stay as the scraper's raw input; triggers link every
+-- written value to an entity, matching spellings through the alias tables.
+
+CREATE TABLE IF NOT EXISTS creators (
+    id         SERIAL PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Every spelling seen for a creator, the canonical one included.
+CREATE TABLE IF NOT EXISTS creator_aliases (
+    creator_id       INTEGER NOT NULL REFERENCES creators(id) ON DELETE CASCADE,
+    alias            VARCHAR(255) NOT NULL,
+    normalized_alias VARCHAR(255) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS creator_aliases_creator_idx ON creator_aliases (creator_id);
+
+CREATE TABLE IF NOT EXISTS manga_creators (
+    manga_id   INTEGER NOT NULL REFERENCES manga(id) ON DELETE CASCADE,
+    creator_id INTEGER NOT NULL REFERENCES creators(id) ON DELETE CASCADE,
+    role       VARCHAR(20) NOT NULL CHECK (role IN ('author', 'artist')),
+    position   INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (manga_id, creator_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS manga_creators_creator_idx ON manga_creators (creator_id);
+
+CREATE TABLE IF NOT EXISTS publishers (
+    id         SERIAL PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS publisher_aliases (
+    publisher_id     INTEGER NOT NULL REFERENCES publishers(id) ON DELETE CASCADE,
+    alias            VARCHAR(255) NOT NULL,
+    normalized_alias VARCHAR(255) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS publisher_aliases_publisher_idx ON publisher_aliases (publisher_id);
+
+ALTER TABLE volumes ADD COLUMN IF NOT EXISTS publisher_id INTEGER REFERENCES publishers(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS volumes_publisher_id_idx ON volumes (publisher_id);
+
+CREATE INDEX IF NOT EXISTS creator_aliases_trgm_idx ON creator_aliases USING GIN (normalized_alias gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS publisher_aliases_trgm_idx ON publisher_aliases USING GIN (normalized_alias gin_trgm_ops);
+
+-- "Takehiko  Inoue" and "takehiko inoue" are the same person.
+CREATE OR REPLACE FUNCTION normalize_entity_name(raw_name TEXT) RETURNS TEXT AS $$
+    SELECT lower(regexp_replace(trim(raw_name), '\s+', ' ', 'g'))
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Publishers also drop punctuation and company suffixes, so "VIZ Media, LLC"
+-- matches "Viz Media".
+CREATE OR REPLACE FUNCTION normalize_publisher_name(raw_name TEXT) RETURNS TEXT AS $$
+    SELECT trim(regexp_replace(
+        regexp_replace(normalize_entity_name(raw_name), '[,.]', '', 'g'),
+        '\s+(inc|llc|ltd|co|corp|corporation)$', ''))
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- creator_id_for returns the creator a spelling belongs to, creating one on
+-- first sight. If a concurrent insert wins the alias, its creator is used.
+CREATE OR REPLACE FUNCTION creator_id_for(raw_name TEXT) RETURNS INTEGER AS $$
+DECLARE
+    normalized TEXT := normalize_entity_name(raw_name);
+    found INTEGER;
+    created INTEGER;
+BEGIN
+    IF normalized IS NULL OR normalized = '' THEN
+        RETURN NULL;
+    END IF;
+    SELECT creator_id INTO found FROM creator_aliases WHERE normalized_alias = normalized;
+    IF found IS NOT NULL THEN
+        RETURN found;
+    END IF;
+
+    INSERT INTO creators (name) VALUES (trim(raw_name)) RETURNING id INTO created;
+    INSERT INTO creator_aliases (creator_id, alias, normalized_alias)
+    VALUES (created, trim(raw_name), normalized)
+    ON CONFLICT (normalized_alias) DO NOTHING;
+    IF NOT FOUND THEN
+        DELETE FROM creators WHERE id = created;
+        SELECT creator_id INTO found FROM creator_aliases WHERE normalized_alias = normalized;
+        RETURN found;
+    END IF;
+    RETURN created;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION publisher_id_for(raw_name TEXT) RETURNS INTEGER AS $$
+DECLARE
+    normalized TEXT := normalize_publisher_name(raw_name);
+    found INTEGER;
+    created INTEGER;
+BEGIN
+    IF normalized IS NULL OR normalized = '' THEN
+        RETURN NULL;
+    END IF;
+    SELECT publisher_id INTO found FROM publisher_aliases WHERE normalized_alias = normalized;
+    IF found IS NOT NULL THEN
+        RETURN found;
+    END IF;
+
+    INSERT INTO publishers (name) VALUES (trim(raw_name)) RETURNING id INTO created;
+    INSERT INTO publisher_aliases (publisher_id, alias, normalized_alias)
+    VALUES (created, trim(raw_name), normalized)
+    ON CONFLICT (normalized_alias) DO NOTHING;
+    IF NOT FOUND THEN
+        DELETE FROM publishers WHERE id = created;
+        SELECT publisher_id INTO found FROM publisher_aliases WHERE normalized_alias = normalized;
+        RETURN found;
+    END IF;
+    RETURN created;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION link_manga_creators() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM manga_creators WHERE manga_id = NEW.id;
+    INSERT INTO manga_creators (manga_id, creator_id, role, position)
+    SELECT NEW.id, c.creator_id, c.role, MIN(c.ord)
+    FROM (
+        SELECT creator_id_for(a.name) AS creator_id, 'author' AS role, a.ord
+        FROM unnest(NEW.authors) WITH ORDINALITY AS a(name, ord)
+        UNION ALL
+        SELECT creator_id_for(a.name), 'artist', a.ord
+        FROM unnest(NEW.artists) WITH ORDINALITY AS a(name, ord)
+    ) c
+    WHERE c.creator_id IS NOT NULL
+    GROUP BY c.creator_id, c.role;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS manga_link_creators ON manga;
+CREATE TRIGGER manga_link_creators
+    AFTER INSERT OR UPDATE OF authors, artists ON manga
+    FOR EACH ROW EXECUTE FUNCTION link_manga_creators();
+
+CREATE OR REPLACE FUNCTION link_volume_publisher() RETURNS trigger AS $$
+BEGIN
+    NEW.publisher_id := publisher_id_for(NEW.publisher);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS volumes_link_publisher ON volumes;
+CREATE TRIGGER volumes_link_publisher
+    BEFORE INSERT OR UPDATE OF publisher ON volumes
+    FOR EACH ROW EXECUTE FUNCTION link_volume_publisher();
+
+-- Migrate existing rows. Touching authors fires manga_link_creators; the
+-- publisher link is set directly so no other volume triggers run.
+UPDATE manga SET authors = authors WHERE authors IS NOT NULL OR artists IS NOT NULL;
+UPDATE volumes SET publisher_id = publisher_id_for(publisher) WHERE publisher IS NOT NULL AND publisher_id IS NULL;
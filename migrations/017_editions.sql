@@ -0,0 +1,145 @@
+-- Editions sit between a series and its volumes: one per language, publisher
+-- and format, e.g. VIZ's English release, its omnibus and the Japanese
+-- tankōbon. Volumes get one on insert (volumes_set_edition), so the scraper
+-- needs no changes; submissions may name an edition or a format.
+
+CREATE TABLE IF NOT EXISTS editions (
+    id           SERIAL PRIMARY KEY,
+    manga_id     INTEGER NOT NULL REFERENCES manga(id) ON DELETE CASCADE,
+    name         VARCHAR(255) NOT NULL,
+    language     VARCHAR(10),
+    publisher_id INTEGER REFERENCES publishers(id) ON DELETE SET NULL,
+    format       VARCHAR(20) NOT NULL DEFAULT 'standard'
+                 CHECK (format IN ('standard', 'tankobon', 'omnibus', 'deluxe', 'hardcover', 'box_set', 'digital', 'other')),
+    -- The edition series-wide actions use when none is given.
+    is_default   BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS editions_identity_idx
+    ON editions (manga_id, COALESCE(language, ''), COALESCE(publisher_id, 0), format);
+CREATE UNIQUE INDEX IF NOT EXISTS editions_default_idx ON editions (manga_id) WHERE is_default;
+
+ALTER TABLE volumes ADD COLUMN IF NOT EXISTS edition_id INTEGER REFERENCES editions(id) ON DELETE SET NULL;
+-- For omnibus and box set volumes: the range of standard volumes collected.
+ALTER TABLE volumes ADD COLUMN IF NOT EXISTS omnibus_start SMALLINT;
+ALTER TABLE volumes ADD COLUMN IF NOT EXISTS omnibus_end SMALLINT;
+ALTER TABLE volumes DROP CONSTRAINT IF EXISTS volumes_omnibus_range_check;
+ALTER TABLE volumes ADD CONSTRAINT volumes_omnibus_range_check
+    CHECK (omnibus_start IS NULL OR omnibus_end IS NULL OR omnibus_start <= omnibus_end);
+
+CREATE INDEX IF NOT EXISTS volumes_edition_idx ON volumes (edition_id, volume_number);
+
+-- edition_id_for returns the edition for a language, publisher and format,
+-- creating it (as the default if the series has none) on first sight.
+-- Without a format Japanese editions are tankōbon and the rest standard.
+CREATE OR REPLACE FUNCTION edition_id_for(edition_manga_id INTEGER, edition_language TEXT, edition_publisher_id INTEGER,
+                                          requested_format TEXT DEFAULT NULL)
+RETURNS INTEGER AS $$
+DECLARE
+    lang TEXT := NULLIF(lower(trim(edition_language)), '');
+    edition_format TEXT := COALESCE(requested_format,
+        CASE WHEN lower(trim(edition_language)) = 'ja' THEN 'tankobon' ELSE 'standard' END);
+    found INTEGER;
+BEGIN
+    IF edition_manga_id IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT id INTO found FROM editions
+    WHERE manga_id = edition_manga_id
+    AND COALESCE(language, '') = COALESCE(lang, '')
+    AND COALESCE(publisher_id, 0) = COALESCE(edition_publisher_id, 0)
+    AND format = edition_format;
+    IF found IS NOT NULL THEN
+        RETURN found;
+    END IF;
+
+    INSERT INTO editions (manga_id, name, language, publisher_id, format, is_default)
+    SELECT edition_manga_id,
+           COALESCE((SELECT name FROM publishers WHERE id = edition_publisher_id), 'Unknown publisher')
+               || COALESCE(' (' || upper(lang) || ')', '')
+               || CASE WHEN edition_format = 'standard' THEN '' ELSE ' ' || edition_format END,
+           lang, edition_publisher_id, edition_format,
+           NOT EXISTS (SELECT 1 FROM editions WHERE manga_id = edition_manga_id AND is_default)
+    ON CONFLICT DO NOTHING
+    RETURNING id INTO found;
+    IF found IS NULL THEN
+        -- Lost a race with a concurrent insert.
+        SELECT id INTO found FROM editions
+        WHERE manga_id = edition_manga_id
+        AND COALESCE(language, '') = COALESCE(lang, '')
+        AND COALESCE(publisher_id, 0) = COALESCE(edition_publisher_id, 0)
+        AND format = edition_format;
+    END IF;
+    RETURN found;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION set_volume_edition() RETURNS trigger AS $$
+BEGIN
+    IF NEW.edition_id IS NULL THEN
+        NEW.edition_id := edition_id_for(NEW.manga_id, NEW.language, NEW.publisher_id);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- BEFORE triggers fire in name order; this one needs publisher_id, which
+-- volumes_link_publisher sets first.
+DROP TRIGGER IF EXISTS volumes_set_edition ON volumes;
+CREATE TRIGGER volumes_set_edition
+    BEFORE INSERT ON volumes
+    FOR EACH ROW EXECUTE FUNCTION set_volume_edition();
+
+-- Existing volumes: create an edition per language and publisher. The one
+-- with the most volumes becomes each series' default.
+INSERT INTO editions (manga_id, name, language, publisher_id, format)
+SELECT DISTINCT ON (v.manga_id, lower(v.language), v.publisher_id)
+       v.manga_id,
+       COALESCE(p.name, 'Unknown publisher')
+           || COALESCE(' (' || upper(NULLIF(lower(trim(v.language)), '')) || ')', '')
+           || CASE WHEN lower(trim(v.language)) = 'ja' THEN ' tankobon' ELSE '' END,
+       NULLIF(lower(trim(v.language)), ''),
+       v.publisher_id,
+       CASE WHEN lower(trim(v.language)) = 'ja' THEN 'tankobon' ELSE 'standard' END
+FROM volumes v
+LEFT JOIN publishers p ON p.id = v.publisher_id
+WHERE v.manga_id IS NOT NULL AND v.edition_id IS NULL
+ORDER BY v.manga_id, lower(v.language), v.publisher_id
+ON CONFLICT DO NOTHING;
+
+UPDATE volumes v SET edition_id = e.id
+FROM editions e
+WHERE v.edition_id IS NULL
+AND e.manga_id = v.manga_id
+AND COALESCE(e.language, '') = COALESCE(NULLIF(lower(trim(v.language)), ''), '')
+AND COALESCE(e.publisher_id, 0) = COALESCE(v.publisher_id, 0)
+AND e.format = CASE WHEN lower(trim(v.language)) = 'ja' THEN 'tankobon' ELSE 'standard' END;
+
+UPDATE editions e SET is_default = TRUE
+FROM (
+    SELECT DISTINCT ON (ed.manga_id) ed.id
+    FROM editions ed
+    LEFT JOIN volumes v ON v.edition_id = ed.id
+    GROUP BY ed.id
+    ORDER BY ed.manga_id, COUNT(v.id) DESC, ed.id
+) best
+WHERE e.id = best.id
+AND NOT EXISTS (SELECT 1 FROM editions d WHERE d.manga_id = e.manga_id AND d.is_default);
+
+-- Submissions can place a volume in an edition: either an existing one
+-- (edition_id) or, by format, one derived from the volume's language and
+-- publisher like volumes_set_edition does. Omnibus and box set volumes also
+-- carry the range of standard volumes they collect.
+ALTER TABLE manga_volume_submissions
+    ADD COLUMN IF NOT EXISTS edition_id INTEGER REFERENCES editions(id) ON DELETE SET NULL;
+ALTER TABLE manga_volume_submissions
+    ADD COLUMN IF NOT EXISTS format VARCHAR(20)
+    CHECK (format IN ('standard', 'tankobon', 'omnibus', 'deluxe', 'hardcover', 'box_set', 'digital', 'other'));
+ALTER TABLE manga_volume_submissions ADD COLUMN IF NOT EXISTS omnibus_start SMALLINT;
+ALTER TABLE manga_volume_submissions ADD COLUMN IF NOT EXISTS omnibus_end SMALLINT;
+ALTER TABLE manga_volume_submissions DROP CONSTRAINT IF EXISTS manga_volume_submissions_omnibus_range_check;
+ALTER TABLE manga_volume_submissions ADD CONSTRAINT manga_volume_submissions_omnibus_range_check
+    CHECK ((omnibus_start IS NULL) = (omnibus_end IS NULL)
+           AND (omnibus_start IS NULL OR (omnibus_start >= 1 AND omnibus_start <= omnibus_end)));
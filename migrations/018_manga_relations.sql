@@ -0,0 +1,24 @@
+-- Relations between series as AniList reports them, written by the scraper.
+-- The related side is kept by AniList ID because it is often not in the
+-- catalog (anime adaptations, series outside the top N); readers join
+-- manga.anilist_id to find the ones that are.
+CREATE TABLE IF NOT EXISTS manga_relations (
+    manga_id           INTEGER NOT NULL REFERENCES manga(id) ON DELETE CASCADE,
+    related_anilist_id INTEGER NOT NULL,
+    relation_type      VARCHAR(20) NOT NULL
+                       CHECK (relation_type IN ('adaptation', 'prequel', 'sequel', 'parent', 'side_story',
+                                                'character', 'summary', 'alternative', 'spin_off', 'other',
+                                                'source', 'compilation', 'contains')),
+    -- AniList's media type (MANGA or ANIME) and format (TV, NOVEL, ONE_SHOT, ...).
+    related_type       VARCHAR(10),
+    related_format     VARCHAR(20),
+    related_title      TEXT,
+    PRIMARY KEY (manga_id, related_anilist_id, relation_type)
+);
+
+CREATE INDEX IF NOT EXISTS manga_relations_related_idx ON manga_relations (related_anilist_id);
+CREATE INDEX IF NOT EXISTS manga_anilist_id_idx ON manga (anilist_id);
+
+-- When the scraper last refreshed a series' relations. Existing series are
+-- NULL and get picked up by the next update cycles.
+ALTER TABLE manga ADD COLUMN IF NOT EXISTS relations_checked_at TIMESTAMP;
@@ -0,0 +1,37 @@
+-- manga-data-service caches catalog responses in memory and LISTENs on
+-- catalog_changed to drop them. Every write to a catalog table notifies with
+-- the affected manga ID; the argument names the column holding it. An empty
+-- payload (a volume without a series) makes listeners flush everything.
+-- Postgres folds identical notifications within a transaction, so bulk
+-- writes send one per series.
+CREATE OR REPLACE FUNCTION notify_catalog_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM pg_notify('catalog_changed', COALESCE(to_jsonb(OLD) ->> TG_ARGV[0], ''));
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM pg_notify('catalog_changed', COALESCE(to_jsonb(NEW) ->> TG_ARGV[0], ''));
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS manga_catalog_changed ON manga;
+CREATE TRIGGER manga_catalog_changed
+    AFTER INSERT OR UPDATE OR DELETE ON manga
+    FOR EACH ROW EXECUTE FUNCTION notify_catalog_changed('id');
+
+DROP TRIGGER IF EXISTS volumes_catalog_changed ON volumes;
+CREATE TRIGGER volumes_catalog_changed
+    AFTER INSERT OR UPDATE OR DELETE ON volumes
+    FOR EACH ROW EXECUTE FUNCTION notify_catalog_changed('manga_id');
+
+DROP TRIGGER IF EXISTS editions_catalog_changed ON editions;
+CREATE TRIGGER editions_catalog_changed
+    AFTER INSERT OR UPDATE OR DELETE ON editions
+    FOR EACH ROW EXECUTE FUNCTION notify_catalog_changed('manga_id');
+
+DROP TRIGGER IF EXISTS manga_relations_catalog_changed ON manga_relations;
+CREATE TRIGGER manga_relations_catalog_changed
+    AFTER INSERT OR UPDATE OR DELETE ON manga_relations
+    FOR EACH ROW EXECUTE FUNCTION notify_catalog_changed('manga_id');
@@ -0,0 +1,95 @@
+-- TEST FIXTURE, NOT THE PRODUCTION SCHEMA. The repo has no checked-in base
+-- schema: users, manga, volumes, user_manga and manga_volume_submissions
+-- predate migrations/ (auth-service and the scraper created them by hand).
+-- This is a hand-written approximation of those tables so the handler tests
+-- can apply every migration on top. It only has the columns the migrations
+-- and handlers use, and its types and constraints are best guesses. Don't
+-- use it to create or repair a real database.
+CREATE TABLE users (
+    id            SERIAL PRIMARY KEY,
+    username      VARCHAR(50) NOT NULL UNIQUE,
+    email         VARCHAR(255) NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL DEFAULT '',
+    user_type     VARCHAR(20) NOT NULL DEFAULT 'user',
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE manga (
+    id                 SERIAL PRIMARY KEY,
+    anilist_id         INTEGER UNIQUE,
+    title_romaji       TEXT,
+    title_english      TEXT,
+    title_native       TEXT,
+    description        TEXT,
+    authors            TEXT[],
+    artists            TEXT[],
+    genres             TEXT[],
+    tags               TEXT[],
+    start_date         DATE,
+    end_date           DATE,
+    status             VARCHAR(20),
+    country_of_origin  VARCHAR(10),
+    total_volumes      SMALLINT,
+    total_chapters     INTEGER,
+    average_score      INTEGER,
+    mean_score         INTEGER,
+    is_adult           BOOLEAN,
+    popularity         INTEGER,
+    cover_image_url    TEXT,
+    cover_image_s3_key TEXT,
+    anilist_url        TEXT,
+    adaptations        JSONB,
+    created_at         TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE volumes (
+    id               SERIAL PRIMARY KEY,
+    manga_id         INTEGER REFERENCES manga(id) ON DELETE CASCADE,
+    title            TEXT,
+    subtitle         TEXT,
+    volume_number    SMALLINT,
+    isbn_13          VARCHAR(13),
+    isbn_10          VARCHAR(10),
+    page_count       SMALLINT,
+    publisher        TEXT,
+    published_date   DATE,
+    description      TEXT,
+    language         VARCHAR(10),
+    categories       TEXT[],
+    price_amount     NUMERIC(10, 2),
+    price_currency   VARCHAR(10),
+    country          VARCHAR(10),
+    preview_link     TEXT,
+    info_link        TEXT,
+    thumbnail_url    TEXT,
+    thumbnail_s3_key TEXT,
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (manga_id, isbn_13)
+);
+
+CREATE TABLE user_manga (
+    user_id         INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    manga_volume_id INTEGER NOT NULL REFERENCES volumes(id) ON DELETE CASCADE,
+    status          VARCHAR(20) NOT NULL CHECK (status IN ('collected', 'wishlisted')),
+    added_at        TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, manga_volume_id)
+);
+
+CREATE TABLE manga_volume_submissions (
+    id                SERIAL PRIMARY KEY,
+    submitter_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    manga_id          INTEGER REFERENCES manga(id) ON DELETE CASCADE,
+    volume_id         INTEGER REFERENCES volumes(id) ON DELETE SET NULL,
+    volume_title      TEXT,
+    volume_number     INTEGER,
+    submission_notes  TEXT,
+    cover_image_url   TEXT,
+    type              VARCHAR(10) NOT NULL DEFAULT 'CREATE',
+    status            VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reviewed_at       TIMESTAMP,
+    reviewed_by       INTEGER REFERENCES users(id),
+    created_at        TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMP NOT NULL DEFAULT NOW()
+);
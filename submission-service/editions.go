@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Formats an edition can have; see migrations/017_editions.sql.
+var editionFormats = map[string]bool{
+	"standard": true, "tankobon": true, "omnibus": true, "deluxe": true,
+	"hardcover": true, "box_set": true, "digital": true, "other": true,
+}
+
+// EditionFields place a submitted volume in an edition of its series.
+// EditionID picks an existing edition; Format instead asks for the edition
+// in that format, which is created on approval if the series has none.
+// Omnibus and box set volumes give the range of volumes they collect.
+type EditionFields struct {
+	EditionID    *int    `json:"edition_id"`
+	Format       *string `json:"format"`
+	OmnibusStart *int    `json:"omnibus_start"`
+	OmnibusEnd   *int    `json:"omnibus_end"`
+}
+
+type editionIntField struct {
+	name string
+	dst  **int
+}
+
+func (f *EditionFields) intFields() []editionIntField {
+	return []editionIntField{
+		{"edition_id", &f.EditionID},
+		{"omnibus_start", &f.OmnibusStart},
+		{"omnibus_end", &f.OmnibusEnd},
+	}
+}
+
+// parseEditionForm reads the edition fields of a multipart submission. It
+// returns an error message for a 400, or "".
+func parseEditionForm(c *gin.Context) (EditionFields, string) {
+	var f EditionFields
+	for _, field := range f.intFields() {
+		raw := strings.TrimSpace(c.Request.FormValue(field.name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return f, "Invalid " + field.name
+		}
+		*field.dst = &n
+	}
+	if format := strings.TrimSpace(c.Request.FormValue("format")); format != "" {
+		f.Format = &format
+	}
+	return f, ""
+}
+
+// withEdits applies the edition fields of an admin edit to f. JSON numbers
+// arrive as float64 and null clears a field. It returns an error message for
+// a 400, or "".
+func (f EditionFields) withEdits(edits map[string]interface{}) (EditionFields, string) {
+	for _, field := range f.intFields() {
+		value, ok := edits[field.name]
+		if !ok {
+			continue
+		}
+		if value == nil {
+			*field.dst = nil
+			continue
+		}
+		n, isNumber := value.(float64)
+		if !isNumber || n != math.Trunc(n) {
+			return f, "Invalid " + field.name
+		}
+		i := int(n)
+		*field.dst = &i
+	}
+	if value, ok := edits["format"]; ok {
+		if value == nil {
+			f.Format = nil
+		} else if format, isString := value.(string); isString {
+			f.Format = &format
+		} else {
+			return f, "Invalid format"
+		}
+	}
+	return f, ""
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// validateEditionFields checks f against the series mangaID. The edition
+// must belong to the series and agree with any format given, and omnibus
+// and box set volumes need a range from 1 up that no other format may have.
+// It returns an error message for a 400, or "".
+func validateEditionFields(q rowQuerier, mangaID int, f EditionFields) (string, error) {
+	if f.Format != nil && !editionFormats[*f.Format] {
+		return "Invalid format", nil
+	}
+	if (f.OmnibusStart == nil) != (f.OmnibusEnd == nil) {
+		return "omnibus_start and omnibus_end must be given together", nil
+	}
+	if f.OmnibusStart != nil && (*f.OmnibusStart < 1 || *f.OmnibusStart > *f.OmnibusEnd) {
+		return "omnibus_start must be at least 1 and no greater than omnibus_end", nil
+	}
+
+	format := f.Format
+	if f.EditionID != nil {
+		var editionFormat string
+		err := q.QueryRow(`SELECT format FROM editions WHERE id = $1 AND manga_id = $2`,
+			*f.EditionID, mangaID).Scan(&editionFormat)
+		if err == sql.ErrNoRows {
+			return "Edition not found for this manga", nil
+		} else if err != nil {
+			return "", err
+		}
+		if format != nil && *format != editionFormat {
+			return fmt.Sprintf("format doesn't match the edition, which is %s", editionFormat), nil
+		}
+		format = &editionFormat
+	}
+
+	if format == nil {
+		return "", nil
+	}
+	collects := *format == "omnibus" || *format == "box_set"
+	if collects && f.OmnibusStart == nil {
+		return "Omnibus and box set volumes need omnibus_start and omnibus_end", nil
+	}
+	if !collects && f.OmnibusStart != nil {
+		return "Only omnibus and box set volumes have a volume range", nil
+	}
+	return "", nil
+}
+
+// loadSubmissionEdition returns a submission's series, which edit and
+// delete submissions take from their volume, and its edition fields.
+func loadSubmissionEdition(q rowQuerier, submissionID string) (sql.NullInt64, EditionFields, error) {
+	var mangaID sql.NullInt64
+	var f EditionFields
+	err := q.QueryRow(`
+		SELECT COALESCE(s.manga_id, v.manga_id), s.edition_id, s.format, s.omnibus_start, s.omnibus_end
+		FROM manga_volume_submissions s
+		LEFT JOIN volumes v ON v.id = s.volume_id
+		WHERE s.id = $1`, submissionID).Scan(&mangaID, &f.EditionID, &f.Format, &f.OmnibusStart, &f.OmnibusEnd)
+	return mangaID, f, err
+}
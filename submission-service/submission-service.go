@@ -45,6 +45,7 @@ type UserSubmissionFetch struct {
 	ApprovalStatus  string  `json:"approval_status"`
 	SubmissionId    int     `json:"submission_id"`
 	TicketType      string  `json:"ticket_type"`
+	EditionFields
 }
 
 // verifyImage scans a multipart image for viruses using ClamAV.
@@ -130,6 +131,7 @@ type UserSubmission struct {
 	SubmissionNotes string `json:"submission_notes"`
 	CoverImageURL   string `json:"cover_image_url"`
 	ApprovalStatus  string `json:"approval_status"`
+	EditionFields
 }
 
 type SubmissionBody struct {
@@ -222,6 +224,31 @@ func verifyUserIsAdmin(user_id int, conn *sql.DB) (bool, string) {
 	return true, ""
 }
 
+// recordSubmissionApproved adds the approval to the submitter's activity
+// feed and awards any approved_submissions achievements (from the shared
+// achievements table) it unlocks. It has to run after the status update and
+// before a delete submission removes its volume.
+func recordSubmissionApproved(tx *sql.Tx, submissionID string) error {
+	_, err := tx.Exec(`INSERT INTO activity_events (user_id, event_type, manga_id, submission_id)
+		SELECT s.submitter_user_id, 'submission_approved', COALESCE(s.manga_id, v.manga_id), s.id
+		FROM manga_volume_submissions s
+		LEFT JOIN volumes v ON v.id = s.volume_id
+		WHERE s.id = $1`, submissionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_achievements (user_id, achievement)
+		SELECT s.submitter_user_id, a.key
+		FROM manga_volume_submissions s
+		JOIN achievements a ON a.metric = 'approved_submissions'
+		WHERE s.id = $1
+		AND a.goal <= (SELECT COUNT(*) FROM manga_volume_submissions x
+		               WHERE x.submitter_user_id = s.submitter_user_id AND x.status = 'approved')
+		ON CONFLICT (user_id, achievement) DO NOTHING`, submissionID)
+	return err
+}
+
 func get_db_conn() (*sql.DB, error) {
 	db := os.Getenv("DATABASE")
 	host := os.Getenv("HOST")
@@ -258,6 +285,11 @@ func createSubmission(c *gin.Context) {
 	volumeTitle := c.Request.FormValue("volume_title")
 	volumeNumber, _ := strconv.Atoi(c.Request.FormValue("volume_number"))
 	submissionNotes := c.Request.FormValue("submission_notes")
+	edition, msg := parseEditionForm(c)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
 
 	// Extract the image file
 	file, _, err := c.Request.FormFile("image")
@@ -332,16 +364,75 @@ func createSubmission(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(
-		`INSERT INTO manga_volume_submissions (submitter_user_id, manga_id, volume_title, volume_number, submission_notes, cover_image_url, type)
-		 VALUES ($1, $2, $3, $4, $5, $6, 'CREATE')`,
-		userID, mangaID, volumeTitle, volumeNumber, submissionNotes, imagePath)
+	// Submissions started from a scanned barcode carry the draft's ISBN.
+	var isbn13 sql.NullString
+	draftID, hasDraft := 0, false
+	if draftIDStr := c.Request.FormValue("draft_id"); draftIDStr != "" {
+		draftID, err = strconv.Atoi(draftIDStr)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid draft_id"})
+			return
+		}
+		err = conn.QueryRow(`SELECT isbn_13 FROM submission_drafts WHERE id = $1 AND user_id = $2`,
+			draftID, userID).Scan(&isbn13)
+		if err == sql.ErrNoRows {
+			c.JSON(404, gin.H{"error": "Draft not found"})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch draft"})
+			return
+		}
+		hasDraft = true
+	}
+
+	msg, err = validateEditionFields(conn, mangaID, edition)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to check edition"})
+		return
+	} else if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(
+		`INSERT INTO manga_volume_submissions (submitter_user_id, manga_id, volume_title, volume_number, submission_notes, cover_image_url, type, isbn_13,
+			edition_id, format, omnibus_start, omnibus_end)
+		 VALUES ($1, $2, $3, $4, $5, $6, 'CREATE', $7, $8, $9, $10, $11)`,
+		userID, mangaID, volumeTitle, volumeNumber, submissionNotes, imagePath, isbn13,
+		edition.EditionID, edition.Format, edition.OmnibusStart, edition.OmnibusEnd)
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(500, gin.H{"error": "Failed to save submission"})
 		return
 	}
 
+	if hasDraft {
+		_, err = tx.Exec(`DELETE FROM submission_drafts WHERE id = $1 AND user_id = $2`, draftID, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to clear draft"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	rollback = false
+
 	c.JSON(200, gin.H{"message": "Submission created successfully"})
 }
 
@@ -369,7 +460,8 @@ func getSubmissionsFromUser(c *gin.Context) {
 			us.cover_image_url, 
 			us.status, 
 			us.id AS submission_id, 
-			us.type as ticket_type
+			us.type as ticket_type,
+			us.edition_id, us.format, us.omnibus_start, us.omnibus_end
 		FROM manga_volume_submissions us
 		JOIN manga m ON us.manga_id = m.id
 		WHERE us.submitter_user_id = $1
@@ -391,6 +483,7 @@ func getSubmissionsFromUser(c *gin.Context) {
 			&s.ApprovalStatus,
 			&s.SubmissionId,
 			&s.TicketType,
+			&s.EditionID, &s.Format, &s.OmnibusStart, &s.OmnibusEnd,
 		)
 		if err != nil {
 			fmt.Println(err)
@@ -416,11 +509,13 @@ func getSubmission(c *gin.Context) {
 
 	var s UserSubmission
 	err = conn.QueryRow(`
-		SELECT m.title_english, us.manga_id, us.volume_title, us.volume_number, us.submission_notes, us.cover_image_url, us.status
+		SELECT m.title_english, us.manga_id, us.volume_title, us.volume_number, us.submission_notes, us.cover_image_url, us.status,
+			us.edition_id, us.format, us.omnibus_start, us.omnibus_end
 		FROM manga_volume_submissions us
 		JOIN manga m ON us.manga_id = m.id
 		WHERE us.id = $1
-	`, id).Scan(&s.TitleEnglish, &s.MangaID, &s.VolumeTitle, &s.VolumeNumber, &s.SubmissionNotes, &s.CoverImageURL, &s.ApprovalStatus)
+	`, id).Scan(&s.TitleEnglish, &s.MangaID, &s.VolumeTitle, &s.VolumeNumber, &s.SubmissionNotes, &s.CoverImageURL, &s.ApprovalStatus,
+		&s.EditionID, &s.Format, &s.OmnibusStart, &s.OmnibusEnd)
 	if err == sql.ErrNoRows {
 		c.JSON(404, gin.H{"error": "Submission not found"})
 		return
@@ -480,7 +575,8 @@ func getSubmissions(c *gin.Context) {
 			us.cover_image_url, 
 			us.status, 
 			us.id AS submission_id,
-			us.type AS ticket_type
+			us.type AS ticket_type,
+			us.edition_id, us.format, us.omnibus_start, us.omnibus_end
 		FROM manga_volume_submissions us
 		JOIN manga m ON us.manga_id = m.id`
 
@@ -508,6 +604,7 @@ func getSubmissions(c *gin.Context) {
 			&s.ApprovalStatus,
 			&s.SubmissionId,
 			&s.TicketType,
+			&s.EditionID, &s.Format, &s.OmnibusStart, &s.OmnibusEnd,
 		)
 		if err != nil {
 			fmt.Println(err)
@@ -552,9 +649,13 @@ func acceptCreateSubmission(c *gin.Context) {
 	var volumeTitle string
 	var volumeNumber int
 	var coverImageURL string
+	var isbn13 sql.NullString
+	var edition EditionFields
 
-	err = conn.QueryRow(`SELECT manga_id, volume_title, volume_number, cover_image_url 
-				FROM manga_volume_submissions WHERE id = $1`, submission_id).Scan(&mangaID, &volumeTitle, &volumeNumber, &coverImageURL)
+	err = conn.QueryRow(`SELECT manga_id, volume_title, volume_number, cover_image_url, isbn_13,
+				edition_id, format, omnibus_start, omnibus_end
+				FROM manga_volume_submissions WHERE id = $1`, submission_id).Scan(&mangaID, &volumeTitle, &volumeNumber, &coverImageURL, &isbn13,
+		&edition.EditionID, &edition.Format, &edition.OmnibusStart, &edition.OmnibusEnd)
 	if err != nil {
 		c.JSON(404, gin.H{"error": "Failed to fetch submission data"})
 		return
@@ -572,10 +673,13 @@ func acceptCreateSubmission(c *gin.Context) {
 		}
 	}()
 
+	// Without an edition or format this is the edition volumes_set_edition
+	// would pick.
 	_, err = tx.Exec(
-		`INSERT INTO volumes (manga_id, title, volume_number, thumbnail_s3_key)
-		 VALUES ($1, $2, $3, $4)`,
-		mangaID, volumeTitle, volumeNumber, coverImageURL,
+		`INSERT INTO volumes (manga_id, title, volume_number, thumbnail_s3_key, isbn_13, edition_id, omnibus_start, omnibus_end)
+		 VALUES ($1, $2, $3, $4, $5, COALESCE($6, edition_id_for($1, NULL, NULL, $7)), $8, $9)`,
+		mangaID, volumeTitle, volumeNumber, coverImageURL, isbn13,
+		edition.EditionID, edition.Format, edition.OmnibusStart, edition.OmnibusEnd,
 	)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to add volume"})
@@ -614,6 +718,12 @@ func acceptCreateSubmission(c *gin.Context) {
 		return
 	}
 
+	if err := recordSubmissionApproved(tx, submission_id); err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to record activity"})
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		c.JSON(500, gin.H{"error": "Failed to commit transaction"})
 		return
@@ -750,7 +860,8 @@ func editSubmission(c *gin.Context) {
 	}()
 
 	// Filtered valid keys and values
-	allowedFields := []string{"manga_id", "volume_title", "volume_number", "status"}
+	allowedFields := []string{"manga_id", "volume_title", "volume_number", "status",
+		"edition_id", "format", "omnibus_start", "omnibus_end"}
 	validEdits := make(map[string]interface{})
 	for key, value := range adminEditSubmission {
 		for _, field := range allowedFields {
@@ -771,8 +882,36 @@ func editSubmission(c *gin.Context) {
 		return
 	}
 
-	// If status changed from accepted to something else, delete volume
 	submission_id := c.Param("submission_id")
+
+	// Check the edition fields as they will be after the edit.
+	mangaID, edition, err := loadSubmissionEdition(tx, submission_id)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "Submission not found"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch submission"})
+		return
+	}
+	edition, msg := edition.withEdits(validEdits)
+	if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	if newMangaID, ok := validEdits["manga_id"].(float64); ok {
+		mangaID = sql.NullInt64{Int64: int64(newMangaID), Valid: true}
+	}
+	msg, err = validateEditionFields(tx, int(mangaID.Int64), edition)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to check edition"})
+		return
+	} else if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
+	// If status changed from accepted to something else, delete volume
 	if validEdits["status"] != nil {
 		var prevStatus string
 		err = conn.QueryRow(`SELECT status FROM manga_volume_submissions WHERE id = $1`, submission_id).Scan(&prevStatus)
@@ -850,9 +989,15 @@ func acceptEditSubmission(c *gin.Context) {
 	var volumeID int
 	var volumeTitle sql.NullString
 	var volumeNumber sql.NullInt64
-
-	err = conn.QueryRow(`SELECT volume_id, volume_title, volume_number 
-				FROM manga_volume_submissions WHERE id = $1`, submission_id).Scan(&volumeID, &volumeTitle, &volumeNumber)
+	var mangaID int
+	var edition EditionFields
+
+	err = conn.QueryRow(`SELECT s.volume_id, s.volume_title, s.volume_number, v.manga_id,
+				s.edition_id, s.format, s.omnibus_start, s.omnibus_end
+				FROM manga_volume_submissions s
+				JOIN volumes v ON v.id = s.volume_id
+				WHERE s.id = $1`, submission_id).Scan(&volumeID, &volumeTitle, &volumeNumber, &mangaID,
+		&edition.EditionID, &edition.Format, &edition.OmnibusStart, &edition.OmnibusEnd)
 	if err == sql.ErrNoRows {
 		c.JSON(404, gin.H{"error": "Failed to fetch submission data"})
 		return
@@ -861,6 +1006,16 @@ func acceptEditSubmission(c *gin.Context) {
 		return
 	}
 
+	msg, err := validateEditionFields(conn, mangaID, edition)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to check edition"})
+		return
+	} else if msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+
 	tx, err := conn.Begin()
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to begin transaction"})
@@ -891,6 +1046,24 @@ func acceptEditSubmission(c *gin.Context) {
 		argIndex++
 	}
 
+	// A format alone moves the volume to that format's edition for its
+	// language and publisher.
+	if edition.EditionID != nil {
+		setClauses = append(setClauses, fmt.Sprintf("edition_id = $%d", argIndex))
+		volArgs = append(volArgs, *edition.EditionID)
+		argIndex++
+	} else if edition.Format != nil {
+		setClauses = append(setClauses, fmt.Sprintf("edition_id = edition_id_for(manga_id, language, publisher_id, $%d)", argIndex))
+		volArgs = append(volArgs, *edition.Format)
+		argIndex++
+	}
+
+	if edition.OmnibusStart != nil {
+		setClauses = append(setClauses, fmt.Sprintf("omnibus_start = $%d, omnibus_end = $%d", argIndex, argIndex+1))
+		volArgs = append(volArgs, *edition.OmnibusStart, *edition.OmnibusEnd)
+		argIndex += 2
+	}
+
 	if len(setClauses) > 0 {
 		updateVolQuery := "UPDATE volumes SET " + strings.Join(setClauses, ", ") + " WHERE id = $1"
 		_, err = tx.Exec(updateVolQuery, volArgs...)
@@ -934,6 +1107,12 @@ func acceptEditSubmission(c *gin.Context) {
 		return
 	}
 
+	if err := recordSubmissionApproved(tx, submission_id); err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to record activity"})
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		c.JSON(500, gin.H{"error": "Failed to commit transaction"})
 		return
@@ -1037,6 +1216,12 @@ func acceptDeleteSubmission(c *gin.Context) {
 		return
 	}
 
+	if err := recordSubmissionApproved(tx, submission_id); err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to record activity"})
+		return
+	}
+
 	// Delete the volume from the database
 	deleteQuery := `DELETE FROM volumes where id = $1`
 
@@ -1083,6 +1268,81 @@ func acceptDeleteSubmission(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "Submission accepted and volume deleted"})
 }
 
+// Drafts are created by user-service when a scanned barcode matches no volume.
+func getSubmissionDrafts(c *gin.Context) {
+	userID, valid := getUserID(c)
+	if !valid {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Database connection error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`
+		SELECT id, isbn_13, isbn_10, intended_status, created_at
+		FROM submission_drafts
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to fetch drafts"})
+		return
+	}
+	defer rows.Close()
+
+	type SubmissionDraft struct {
+		DraftID        int       `json:"draft_id"`
+		ISBN13         string    `json:"isbn_13"`
+		ISBN10         *string   `json:"isbn_10"`
+		IntendedStatus string    `json:"intended_status"`
+		CreatedAt      time.Time `json:"created_at"`
+	}
+
+	drafts := []SubmissionDraft{}
+	for rows.Next() {
+		var d SubmissionDraft
+		if err := rows.Scan(&d.DraftID, &d.ISBN13, &d.ISBN10, &d.IntendedStatus, &d.CreatedAt); err != nil {
+			fmt.Println(err)
+			c.JSON(500, gin.H{"error": "Error scanning draft"})
+			return
+		}
+		drafts = append(drafts, d)
+	}
+
+	c.JSON(200, gin.H{"drafts": drafts})
+}
+
+func deleteSubmissionDraft(c *gin.Context) {
+	userID, valid := getUserID(c)
+	if !valid {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Database connection error"})
+		return
+	}
+	defer conn.Close()
+
+	res, err := conn.Exec(`DELETE FROM submission_drafts WHERE id = $1 AND user_id = $2`, c.Param("draft_id"), userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete draft"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "Draft not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Draft deleted"})
+}
+
 func main() {
 	router := gin.Default()
 
@@ -1090,6 +1350,8 @@ func main() {
 	router.POST("/submissions", createSubmission)                     // body passes in user_id
 	router.GET("/submissions/users/:user_id", getSubmissionsFromUser) // gets all submissions from a user
 	router.GET("/submissions/:id", getSubmission)                     // get a specific submission info
+	router.GET("/submissions/drafts", getSubmissionDrafts)            // scanned ISBNs waiting to become submissions
+	router.DELETE("/submissions/drafts/:draft_id", deleteSubmissionDraft)
 
 	router.GET("/admin/submissions", getSubmissions)                                  // List all submissions, takes body with filters, no filters for now
 	router.POST("/admin/submissions/:submission_id/accept", acceptCreateSubmission)   // approve "create" submissions, add volume
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// An achievement is earned once metric reaches Goal. The definitions live in
+// the achievements table (migrations/012_achievements.sql), which
+// submission-service also reads to award the approved_submissions ones.
+type achievementDef struct {
+	Key         string
+	Name        string
+	Description string
+	metric      string
+	Goal        int
+}
+
+// achievementQuerier is satisfied by both *sql.DB and *sql.Tx.
+type achievementQuerier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func loadAchievementDefs(q achievementQuerier) ([]achievementDef, error) {
+	rows, err := q.Query(`SELECT key, name, description, metric, goal FROM achievements ORDER BY position, key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var defs []achievementDef
+	for rows.Next() {
+		var def achievementDef
+		if err := rows.Scan(&def.Key, &def.Name, &def.Description, &def.metric, &def.Goal); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+type Achievement struct {
+	Key         string     `json:"key"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Goal        int        `json:"goal"`
+	Progress    int        `json:"progress"`
+	Earned      bool       `json:"earned"`
+	AwardedAt   *time.Time `json:"awarded_at"`
+}
+
+// achievementMetrics computes every metric an achievement can refer to. A
+// series counts as completed when it has finished publishing and the user
+// has collected all known volumes of one of its editions.
+func achievementMetrics(tx *sql.Tx, userID int) (map[string]int, error) {
+	var volumes, series, completed, publishers, submissions int
+	err := tx.QueryRow(`
+		WITH collected AS (
+			SELECT v.id, v.manga_id, v.edition_id, v.publisher_id
+			FROM user_manga um
+			JOIN volumes v ON v.id = um.manga_volume_id
+			WHERE um.user_id = $1 AND um.status = 'collected'
+		)
+		SELECT
+			(SELECT COUNT(*) FROM collected),
+			(SELECT COUNT(DISTINCT manga_id) FROM collected),
+			(SELECT COUNT(DISTINCT done.manga_id) FROM (
+				SELECT v.manga_id
+				FROM volumes v
+				JOIN manga m ON m.id = v.manga_id
+				LEFT JOIN user_manga um ON um.manga_volume_id = v.id AND um.user_id = $1
+				WHERE v.edition_id IN (SELECT edition_id FROM collected) AND m.status = 'FINISHED'
+				GROUP BY v.manga_id, v.edition_id
+				HAVING bool_and(COALESCE(um.status = 'collected', FALSE))
+			) done),
+			(SELECT COUNT(DISTINCT publisher_id) FROM collected),
+			(SELECT COUNT(*) FROM manga_volume_submissions WHERE submitter_user_id = $1 AND status = 'approved')
+	`, userID).Scan(&volumes, &series, &completed, &publishers, &submissions)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{
+		"volumes":              volumes,
+		"series":               series,
+		"completed_series":     completed,
+		"publishers":           publishers,
+		"approved_submissions": submissions,
+	}, nil
+}
+
+// awardAchievements records every achievement userID has reached but not
+// been awarded yet. It is idempotent, so it can run after any collection
+// change and from the backfill.
+func awardAchievements(tx *sql.Tx, userID int) error {
+	defs, err := loadAchievementDefs(tx)
+	if err != nil {
+		return err
+	}
+	metrics, err := achievementMetrics(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	var reached []string
+	for _, def := range defs {
+		if metrics[def.metric] >= def.Goal {
+			reached = append(reached, def.Key)
+		}
+	}
+	if len(reached) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_achievements (user_id, achievement)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, achievement) DO NOTHING`, userID, pq.Array(reached))
+	return err
+}
+
+func loadAchievements(conn *sql.DB, userID int, withProgress bool) ([]Achievement, error) {
+	defs, err := loadAchievementDefs(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	awarded := map[string]time.Time{}
+	rows, err := conn.Query(`SELECT achievement, awarded_at FROM user_achievements WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var at time.Time
+		if err := rows.Scan(&key, &at); err != nil {
+			return nil, err
+		}
+		awarded[key] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var metrics map[string]int
+	if withProgress {
+		tx, err := conn.Begin()
+		if err != nil {
+			return nil, err
+		}
+		metrics, err = achievementMetrics(tx, userID)
+		tx.Rollback()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := []Achievement{}
+	for _, def := range defs {
+		a := Achievement{Key: def.Key, Name: def.Name, Description: def.Description, Goal: def.Goal}
+		if at, ok := awarded[def.Key]; ok {
+			a.Earned = true
+			a.AwardedAt = &at
+			a.Progress = def.Goal
+		}
+		if metrics != nil && !a.Earned {
+			a.Progress = min(metrics[def.metric], def.Goal)
+		}
+		if a.Earned || withProgress {
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
+// getAchievements lists every achievement with the caller's progress
+// towards the ones they haven't earned yet.
+func getAchievements(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	achievements, err := loadAchievements(conn, userID, true)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get achievements"})
+		return
+	}
+	c.JSON(200, gin.H{"achievements": achievements})
+}
+
+// getUserAchievements lists the badges another user has earned, if their
+// profile is visible to the caller.
+func getUserAchievements(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+	ownerID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	username, ok := getUsernameByID(conn, ownerID)
+	if !ok {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	access, err := resolveProfileAccess(conn, userID, ownerID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+		return
+	}
+	if !access.Profile {
+		c.JSON(403, gin.H{"error": "This profile is private", "isOwner": userID == ownerID, "username": username})
+		return
+	}
+
+	achievements, err := loadAchievements(conn, ownerID, false)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get achievements"})
+		return
+	}
+	c.JSON(200, gin.H{"achievements": achievements, "username": username})
+}
+
+// backfillAchievements awards achievements to every existing user. It backs
+// "user-service achievements" and only needs to run once after the
+// achievements migration, though running it again is harmless.
+func backfillAchievements() error {
+	conn, err := get_db_conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`SELECT id FROM users ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, id := range userIDs {
+		err := func() error {
+			tx, err := conn.Begin()
+			if err != nil {
+				return err
+			}
+			if err := awardAchievements(tx, id); err != nil {
+				tx.Rollback()
+				return err
+			}
+			return tx.Commit()
+		}()
+		if err != nil {
+			fmt.Printf("achievements: user %d: %v\n", id, err)
+			failed++
+		}
+	}
+
+	fmt.Printf("achievements: checked %d users, %d failed\n", len(userIDs), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d users failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+var errUndoConflict = errors.New("volume changed after this event")
+
+// State of one user_manga row, with the whole row kept as JSON so undo can
+// restore columns the log does not index on.
+type userMangaState struct {
+	Status  string
+	AddedAt time.Time
+	Row     string
+}
+
+func newBatchID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// snapshotUserManga locks and returns the user's rows for volumeIDs, keyed by
+// volume id. Volumes without a row are absent from the map.
+func snapshotUserManga(tx *sql.Tx, userID int, volumeIDs []int) (map[int]userMangaState, error) {
+	rows, err := tx.Query(`
+		SELECT um.manga_volume_id, um.status, um.added_at, to_jsonb(um)::text
+		FROM user_manga um
+		WHERE um.user_id = $1 AND um.manga_volume_id = ANY($2)
+		FOR UPDATE
+	`, userID, pq.Array(volumeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[int]userMangaState)
+	for rows.Next() {
+		var volumeID int
+		var s userMangaState
+		if err := rows.Scan(&volumeID, &s.Status, &s.AddedAt, &s.Row); err != nil {
+			return nil, err
+		}
+		states[volumeID] = s
+	}
+	return states, rows.Err()
+}
+
+// logCollectionChanges appends one event per volume whose row differs
+// between before and after. reverts maps a volume to the event being undone.
+func logCollectionChanges(tx *sql.Tx, userID int, batchID string, source string, volumeIDs []int,
+	before, after map[int]userMangaState, reverts map[int]int64) (int, error) {
+
+	// A sorted copy: callers still use volumeIDs afterwards.
+	sorted := slices.Sorted(slices.Values(volumeIDs))
+	logged := 0
+	for i, volumeID := range sorted {
+		if i > 0 && sorted[i-1] == volumeID {
+			continue
+		}
+
+		old, hadOld := before[volumeID]
+		cur, hasNew := after[volumeID]
+
+		var action string
+		switch {
+		case !hadOld && hasNew:
+			action = "added"
+		case hadOld && !hasNew:
+			action = "removed"
+		case hadOld && hasNew && old.Row != cur.Row:
+			action = "updated"
+		default:
+			continue
+		}
+
+		var oldStatus, newStatus, oldRow, newRow sql.NullString
+		var oldAddedAt, newAddedAt sql.NullTime
+		if hadOld {
+			oldStatus = sql.NullString{String: old.Status, Valid: true}
+			oldAddedAt = sql.NullTime{Time: old.AddedAt, Valid: true}
+			oldRow = sql.NullString{String: old.Row, Valid: true}
+		}
+		if hasNew {
+			newStatus = sql.NullString{String: cur.Status, Valid: true}
+			newAddedAt = sql.NullTime{Time: cur.AddedAt, Valid: true}
+			newRow = sql.NullString{String: cur.Row, Valid: true}
+		}
+
+		var revertsEventID sql.NullInt64
+		if id, ok := reverts[volumeID]; ok {
+			revertsEventID = sql.NullInt64{Int64: id, Valid: true}
+		}
+
+		_, err := tx.Exec(`INSERT INTO user_manga_events
+			(user_id, manga_volume_id, batch_id, source, action, old_status, new_status,
+			 old_added_at, new_added_at, old_row, new_row, reverts_event_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::jsonb, $11::jsonb, $12)`,
+			userID, volumeID, batchID, source, action, oldStatus, newStatus,
+			oldAddedAt, newAddedAt, oldRow, newRow, revertsEventID)
+		if err != nil {
+			return logged, err
+		}
+		logged++
+	}
+	return logged, nil
+}
+
+// applyCollectionChange runs fn in a transaction and logs every change it
+// made to the user's rows for volumeIDs as one batch. The batch id is empty
+// when fn changed nothing.
+func applyCollectionChange(conn *sql.DB, userID int, source string, volumeIDs []int, fn func(tx *sql.Tx) error) (string, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return "", err
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	batchID, err := applyCollectionChangeTx(tx, userID, source, volumeIDs, fn)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	rollback = false
+
+	return batchID, nil
+}
+
+// applyCollectionChangeTx is applyCollectionChange inside a transaction the
+// caller owns, for changes that touch more than one user's rows at once.
+func applyCollectionChangeTx(tx *sql.Tx, userID int, source string, volumeIDs []int, fn func(tx *sql.Tx) error) (string, error) {
+	before, err := snapshotUserManga(tx, userID, volumeIDs)
+	if err != nil {
+		return "", err
+	}
+	if err := fn(tx); err != nil {
+		return "", err
+	}
+	after, err := snapshotUserManga(tx, userID, volumeIDs)
+	if err != nil {
+		return "", err
+	}
+
+	batchID, err := newBatchID()
+	if err != nil {
+		return "", err
+	}
+	logged, err := logCollectionChanges(tx, userID, batchID, source, volumeIDs, before, after, nil)
+	if err != nil {
+		return "", err
+	}
+	if logged == 0 {
+		return "", nil
+	}
+	if err := recordCollectionActivity(tx, userID, batchID); err != nil {
+		return "", err
+	}
+	if err := awardAchievements(tx, userID); err != nil {
+		return "", err
+	}
+	return batchID, nil
+}
+
+// seriesEdition is the edition a whole-series move applies to.
+type seriesEdition struct {
+	ID        int
+	VolumeIDs []int
+	// Others counts the series' other editions, which the move leaves alone.
+	Others int
+}
+
+// mangaEdition resolves editionID, or the series' default edition when it
+// is 0, and lists its volumes. found is false when editionID isn't an
+// edition of the series.
+func mangaEdition(conn *sql.DB, mangaID int, editionID int) (ed seriesEdition, found bool, err error) {
+	err = conn.QueryRow(`SELECT e.id, (SELECT COUNT(*) FROM editions o WHERE o.manga_id = e.manga_id AND o.id <> e.id)
+		FROM editions e
+		WHERE e.manga_id = $1 AND (e.id = $2 OR ($2 = 0 AND e.is_default))`, mangaID, editionID).Scan(&ed.ID, &ed.Others)
+	if err == sql.ErrNoRows {
+		// A series without volumes has no editions, so nothing to move.
+		return ed, editionID == 0, nil
+	}
+	if err != nil {
+		return ed, false, err
+	}
+
+	rows, err := conn.Query(`SELECT id FROM volumes WHERE edition_id = $1`, ed.ID)
+	if err != nil {
+		return ed, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return ed, false, err
+		}
+		ed.VolumeIDs = append(ed.VolumeIDs, id)
+	}
+	return ed, true, rows.Err()
+}
+
+type CollectionEvent struct {
+	ID             int64      `json:"id"`
+	BatchID        string     `json:"batch_id"`
+	Source         string     `json:"source"`
+	Action         string     `json:"action"`
+	VolumeID       int        `json:"volume_id"`
+	VolumeTitle    string     `json:"volume_title"`
+	MangaID        int        `json:"manga_id"`
+	OldStatus      *string    `json:"old_status"`
+	NewStatus      *string    `json:"new_status"`
+	OldAddedAt     *time.Time `json:"old_added_at"`
+	NewAddedAt     *time.Time `json:"new_added_at"`
+	RevertsEventID *int64     `json:"reverts_event_id"`
+	Undone         bool       `json:"undone"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// getCollectionHistory lists the caller's changes newest first. Page with
+// ?before=<id of the last event seen>.
+func getCollectionHistory(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	before, err := strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid before"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`
+		SELECT e.id, e.batch_id, e.source, e.action, e.manga_volume_id, v.title, v.manga_id,
+		       e.old_status, e.new_status, e.old_added_at, e.new_added_at, e.reverts_event_id,
+		       EXISTS (SELECT 1 FROM user_manga_events r WHERE r.reverts_event_id = e.id),
+		       e.created_at
+		FROM user_manga_events e
+		JOIN volumes v ON v.id = e.manga_volume_id
+		WHERE e.user_id = $1
+		AND ($2 = 0 OR e.id < $2)
+		ORDER BY e.id DESC
+		LIMIT $3
+	`, userID, before, limit+1)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get history"})
+		return
+	}
+	defer rows.Close()
+
+	events := []CollectionEvent{}
+	for rows.Next() {
+		var e CollectionEvent
+		err := rows.Scan(&e.ID, &e.BatchID, &e.Source, &e.Action, &e.VolumeID, &e.VolumeTitle, &e.MangaID,
+			&e.OldStatus, &e.NewStatus, &e.OldAddedAt, &e.NewAddedAt, &e.RevertsEventID,
+			&e.Undone, &e.CreatedAt)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		events = append(events, e)
+	}
+
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+
+	c.JSON(200, gin.H{"events": events, "hasMore": hasMore})
+}
+
+type undoTarget struct {
+	eventID  int64
+	volumeID int
+	oldRow   sql.NullString
+	newRow   sql.NullString
+}
+
+// undoEvents restores the "before" row of each target, newest first. It
+// refuses when a volume has changed since its event, so undoing an old
+// change never silently discards a newer one.
+func undoEvents(conn *sql.DB, userID int, targets []undoTarget) (string, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return "", err
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	volumeIDs := make([]int, 0, len(targets))
+	reverts := make(map[int]int64)
+	for _, t := range targets {
+		volumeIDs = append(volumeIDs, t.volumeID)
+		reverts[t.volumeID] = t.eventID
+	}
+
+	before, err := snapshotUserManga(tx, userID, volumeIDs)
+	if err != nil {
+		return "", err
+	}
+
+	for _, t := range targets {
+		var current sql.NullString
+		if s, ok := before[t.volumeID]; ok {
+			current = sql.NullString{String: s.Row, Valid: true}
+		}
+
+		var unchanged bool
+		err := tx.QueryRow(`SELECT $1::jsonb IS NOT DISTINCT FROM $2::jsonb`, current, t.newRow).Scan(&unchanged)
+		if err != nil {
+			return "", err
+		}
+		if !unchanged {
+			return "", errUndoConflict
+		}
+
+		_, err = tx.Exec(`DELETE FROM user_manga WHERE user_id = $1 AND manga_volume_id = $2`, userID, t.volumeID)
+		if err != nil {
+			return "", err
+		}
+		if t.oldRow.Valid {
+			_, err = tx.Exec(`INSERT INTO user_manga
+				SELECT * FROM jsonb_populate_record(NULL::user_manga, $1::jsonb)`, t.oldRow)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	after, err := snapshotUserManga(tx, userID, volumeIDs)
+	if err != nil {
+		return "", err
+	}
+
+	batchID, err := newBatchID()
+	if err != nil {
+		return "", err
+	}
+	if _, err := logCollectionChanges(tx, userID, batchID, "undo", volumeIDs, before, after, reverts); err != nil {
+		return "", err
+	}
+
+	eventIDs := make([]int64, 0, len(targets))
+	for _, t := range targets {
+		eventIDs = append(eventIDs, t.eventID)
+	}
+	if err := retractCollectionActivity(tx, userID, eventIDs); err != nil {
+		return "", err
+	}
+	if err := awardAchievements(tx, userID); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	rollback = false
+
+	return batchID, nil
+}
+
+func loadUndoTargets(conn *sql.DB, userID int, where string, arg any) ([]undoTarget, error) {
+	rows, err := conn.Query(`
+		SELECT e.id, e.manga_volume_id, e.old_row::text, e.new_row::text
+		FROM user_manga_events e
+		WHERE e.user_id = $1 AND `+where+`
+		AND NOT EXISTS (SELECT 1 FROM user_manga_events r WHERE r.reverts_event_id = e.id)
+		ORDER BY e.id DESC
+	`, userID, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []undoTarget
+	for rows.Next() {
+		var t undoTarget
+		if err := rows.Scan(&t.eventID, &t.volumeID, &t.oldRow, &t.newRow); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+func respondUndo(c *gin.Context, conn *sql.DB, userID int, targets []undoTarget) {
+	if len(targets) == 0 {
+		c.JSON(404, gin.H{"error": "Nothing to undo"})
+		return
+	}
+
+	batchID, err := undoEvents(conn, userID, targets)
+	if errors.Is(err, errUndoConflict) {
+		c.JSON(409, gin.H{"error": "This volume has changed since, undo the newer changes first"})
+		return
+	} else if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to undo"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
+}
+
+func undoCollectionEvent(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	eventID, err := strconv.ParseInt(c.Param("event_id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	targets, err := loadUndoTargets(conn, userID, "e.id = $2", eventID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load event"})
+		return
+	}
+	respondUndo(c, conn, userID, targets)
+}
+
+func undoCollectionBatch(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	targets, err := loadUndoTargets(conn, userID, "e.batch_id = $2", c.Param("batch_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load batch"})
+		return
+	}
+	respondUndo(c, conn, userID, targets)
+}
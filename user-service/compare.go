@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+type CompareVolume struct {
+	VolumeID       int     `json:"volume_id"`
+	VolumeTitle    string  `json:"volume_title"`
+	VolumeNumber   *int    `json:"volume_number"`
+	ThumbnailS3Key *string `json:"thumbnail_s3_key"`
+	MangaID        int     `json:"manga_id"`
+	MangaTitle     *string `json:"manga_title"`
+}
+
+type CompareSeries struct {
+	MangaID        int     `json:"manga_id"`
+	MangaTitle     *string `json:"manga_title"`
+	FirstCollected int     `json:"first_user_collected"`
+	OtherCollected int     `json:"second_user_collected"`
+	TotalVolumes   int     `json:"total_volumes"`
+}
+
+// Volumes fromUser has with status fromStatus that toUser has with status
+// toStatus. With gapsOnly, toStatus is ignored and the volumes returned are
+// the ones toUser has not collected from series toUser collects.
+func compareVolumes(conn *sql.DB, fromUser int, fromStatus string, toUser int, toStatus string, gapsOnly bool) ([]CompareVolume, error) {
+	query := `
+		SELECT v.id, v.title, v.volume_number, v.thumbnail_s3_key, m.id, COALESCE(m.title_english, m.title_romaji)
+		FROM user_manga a
+		JOIN volumes v ON v.id = a.manga_volume_id
+		JOIN manga m ON m.id = v.manga_id
+		WHERE a.user_id = $1 AND a.status = $2`
+	args := []any{fromUser, fromStatus, toUser}
+	if gapsOnly {
+		query += `
+		AND NOT EXISTS (
+			SELECT 1 FROM user_manga b
+			WHERE b.user_id = $3 AND b.manga_volume_id = v.id AND b.status = 'collected'
+		)
+		AND EXISTS (
+			SELECT 1 FROM user_manga b
+			JOIN volumes bv ON bv.id = b.manga_volume_id
+			WHERE b.user_id = $3 AND b.status = 'collected' AND bv.manga_id = v.manga_id
+		)`
+	} else {
+		query += `
+		AND EXISTS (
+			SELECT 1 FROM user_manga b
+			WHERE b.user_id = $3 AND b.manga_volume_id = v.id AND b.status = $4
+		)`
+		args = append(args, toStatus)
+	}
+	query += `
+		ORDER BY 6, v.volume_number NULLS LAST, v.id`
+
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	volumes := []CompareVolume{}
+	for rows.Next() {
+		var v CompareVolume
+		if err := rows.Scan(&v.VolumeID, &v.VolumeTitle, &v.VolumeNumber, &v.ThumbnailS3Key, &v.MangaID, &v.MangaTitle); err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes, rows.Err()
+}
+
+func sharedSeries(conn *sql.DB, firstUser int, otherUser int) ([]CompareSeries, error) {
+	rows, err := conn.Query(`
+		WITH counts AS (
+			SELECT v.manga_id,
+			       COUNT(*) FILTER (WHERE um.user_id = $1) AS first_collected,
+			       COUNT(*) FILTER (WHERE um.user_id = $2) AS other_collected
+			FROM user_manga um
+			JOIN volumes v ON v.id = um.manga_volume_id
+			WHERE um.user_id IN ($1, $2) AND um.status = 'collected'
+			GROUP BY v.manga_id
+		)
+		SELECT m.id, COALESCE(m.title_english, m.title_romaji), c.first_collected, c.other_collected,
+		       (SELECT COUNT(*) FROM volumes v WHERE v.manga_id = m.id)
+		FROM counts c
+		JOIN manga m ON m.id = c.manga_id
+		WHERE c.first_collected > 0 AND c.other_collected > 0
+		ORDER BY 2
+	`, firstUser, otherUser)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []CompareSeries{}
+	for rows.Next() {
+		var s CompareSeries
+		if err := rows.Scan(&s.MangaID, &s.MangaTitle, &s.FirstCollected, &s.OtherCollected, &s.TotalVolumes); err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+	return series, rows.Err()
+}
+
+// compareCollections compares two users for trading and gift buying. Each
+// section needs the caller to be able to see the lists it is built from;
+// sections they can't see are left out and named in "hidden".
+func compareCollections(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	firstID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	otherID, err := strconv.Atoi(c.Param("other_user_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if firstID == otherID {
+		c.JSON(400, gin.H{"error": "Pick two different users"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	firstName, ok := getUsernameByID(conn, firstID)
+	if !ok {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+	otherName, ok := getUsernameByID(conn, otherID)
+	if !ok {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	first, err := resolveProfileAccess(conn, userID, firstID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+		return
+	}
+	other, err := resolveProfileAccess(conn, userID, otherID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+		return
+	}
+	if !first.Profile || !other.Profile {
+		c.JSON(403, gin.H{"error": "This profile is private"})
+		return
+	}
+
+	response := gin.H{
+		"first_user":  gin.H{"user_id": firstID, "username": firstName},
+		"second_user": gin.H{"user_id": otherID, "username": otherName},
+	}
+	hidden := []string{}
+
+	sections := []struct {
+		name    string
+		visible bool
+		load    func() (any, error)
+	}{
+		{"first_has_second_wants", first.Collection && other.Wishlist, func() (any, error) {
+			return compareVolumes(conn, firstID, "collected", otherID, "wishlisted", false)
+		}},
+		{"second_has_first_wants", other.Collection && first.Wishlist, func() (any, error) {
+			return compareVolumes(conn, otherID, "collected", firstID, "wishlisted", false)
+		}},
+		{"shared_series", first.Collection && other.Collection, func() (any, error) {
+			return sharedSeries(conn, firstID, otherID)
+		}},
+		{"first_gaps_second_can_fill", first.Collection && other.Collection, func() (any, error) {
+			return compareVolumes(conn, otherID, "collected", firstID, "", true)
+		}},
+		{"second_gaps_first_can_fill", first.Collection && other.Collection, func() (any, error) {
+			return compareVolumes(conn, firstID, "collected", otherID, "", true)
+		}},
+	}
+
+	for _, section := range sections {
+		if !section.visible {
+			hidden = append(hidden, section.name)
+			continue
+		}
+		result, err := section.load()
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(500, gin.H{"error": "Failed to compare collections"})
+			return
+		}
+		response[section.name] = result
+	}
+	response["hidden"] = hidden
+
+	c.JSON(200, response)
+}
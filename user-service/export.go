@@ -0,0 +1,290 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+// Rows are flushed to the client in batches of this size while exporting.
+const exportFlushEvery = 200
+
+type ExportRow struct {
+	VolumeID     int       `json:"volume_id"`
+	MangaID      int       `json:"manga_id"`
+	SeriesTitle  string    `json:"series_title"`
+	Authors      string    `json:"authors"`
+	VolumeTitle  string    `json:"volume_title"`
+	VolumeNumber *int      `json:"volume_number"`
+	ISBN13       string    `json:"isbn_13"`
+	ISBN10       string    `json:"isbn_10"`
+	Publisher    string    `json:"publisher"`
+	Status       string    `json:"status"`
+	AddedAt      time.Time `json:"added_at"`
+}
+
+// exportWriter receives one row at a time so large libraries never have to
+// be held in memory.
+type exportWriter interface {
+	begin() error
+	write(row ExportRow) error
+	flush()
+	end() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) begin() error {
+	return e.w.Write([]string{"series_title", "volume_title", "volume_number", "isbn_13", "isbn_10",
+		"publisher", "authors", "status", "added_at", "manga_id", "volume_id"})
+}
+
+func (e *csvExportWriter) write(row ExportRow) error {
+	volumeNumber := ""
+	if row.VolumeNumber != nil {
+		volumeNumber = strconv.Itoa(*row.VolumeNumber)
+	}
+	return e.w.Write([]string{row.SeriesTitle, row.VolumeTitle, volumeNumber, row.ISBN13, row.ISBN10,
+		row.Publisher, row.Authors, row.Status, row.AddedAt.Format(time.RFC3339),
+		strconv.Itoa(row.MangaID), strconv.Itoa(row.VolumeID)})
+}
+
+func (e *csvExportWriter) flush() {
+	e.w.Flush()
+}
+
+func (e *csvExportWriter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// goodreadsExportWriter produces the columns Goodreads' "Import library"
+// page understands. Wishlisted volumes land on the to-read shelf.
+type goodreadsExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *goodreadsExportWriter) begin() error {
+	return e.w.Write([]string{"Title", "Author", "ISBN", "ISBN13", "Publisher",
+		"Date Added", "Exclusive Shelf", "Bookshelves"})
+}
+
+func (e *goodreadsExportWriter) write(row ExportRow) error {
+	shelf, bookshelves := "read", "owned"
+	if row.Status == "wishlisted" {
+		shelf, bookshelves = "to-read", "wishlist"
+	}
+	return e.w.Write([]string{row.VolumeTitle, row.Authors, row.ISBN10, row.ISBN13, row.Publisher,
+		row.AddedAt.Format("2006/01/02"), shelf, bookshelves})
+}
+
+func (e *goodreadsExportWriter) flush() {
+	e.w.Flush()
+}
+
+func (e *goodreadsExportWriter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonExportWriter struct {
+	c     *gin.Context
+	count int
+}
+
+func (e *jsonExportWriter) begin() error {
+	_, err := e.c.Writer.WriteString("[")
+	return err
+}
+
+func (e *jsonExportWriter) write(row ExportRow) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := e.c.Writer.WriteString(","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.c.Writer.Write(data)
+	return err
+}
+
+func (e *jsonExportWriter) flush() {}
+
+func (e *jsonExportWriter) end() error {
+	_, err := e.c.Writer.WriteString("]")
+	return err
+}
+
+// printExportWriter renders a plain HTML checklist meant for printing.
+type printExportWriter struct {
+	c *gin.Context
+}
+
+func (e *printExportWriter) begin() error {
+	_, err := e.c.Writer.WriteString(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>MangaCollect export</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse;width:100%}td,th{border:1px solid #999;padding:4px;text-align:left}</style>
+</head><body><h1>MangaCollect export</h1>
+<table><tr><th>Series</th><th>Volume</th><th>Title</th><th>ISBN</th><th>Publisher</th><th>Status</th><th>Added</th></tr>
+`)
+	return err
+}
+
+func (e *printExportWriter) write(row ExportRow) error {
+	volumeNumber := ""
+	if row.VolumeNumber != nil {
+		volumeNumber = strconv.Itoa(*row.VolumeNumber)
+	}
+	isbn := row.ISBN13
+	if isbn == "" {
+		isbn = row.ISBN10
+	}
+	_, err := fmt.Fprintf(e.c.Writer, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+		html.EscapeString(row.SeriesTitle), volumeNumber, html.EscapeString(row.VolumeTitle),
+		html.EscapeString(isbn), html.EscapeString(row.Publisher), row.Status, row.AddedAt.Format("2006-01-02"))
+	return err
+}
+
+func (e *printExportWriter) flush() {}
+
+func (e *printExportWriter) end() error {
+	_, err := e.c.Writer.WriteString("</table></body></html>\n")
+	return err
+}
+
+// exportCollection streams the caller's collection and/or wishlist. It takes
+// the same filters as the listing endpoints: type (collected, wishlisted,
+// all) and an optional manga_id.
+func exportCollection(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	mangaType := c.DefaultQuery("type", "all")
+	if mangaType != "wishlisted" && mangaType != "collected" && mangaType != "all" {
+		c.JSON(400, gin.H{"error": "Invalid type"})
+		return
+	}
+
+	query := `
+		SELECT v.id, v.manga_id, COALESCE(m.title_english, m.title_romaji, ''),
+		       COALESCE(array_to_string(m.authors, ', '), ''),
+		       v.title, v.volume_number, v.isbn_13, v.isbn_10, v.publisher,
+		       um.status, um.added_at
+		FROM user_manga um
+		JOIN volumes v ON v.id = um.manga_volume_id
+		JOIN manga m ON m.id = v.manga_id
+		WHERE um.user_id = $1`
+	args := []any{userID}
+
+	if mangaType != "all" {
+		args = append(args, mangaType)
+		query += fmt.Sprintf(" AND um.status = $%d", len(args))
+	}
+	if mangaIDStr, found := c.GetQuery("manga_id"); found {
+		mangaID, err := strconv.Atoi(mangaIDStr)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid manga_id"})
+			return
+		}
+		args = append(args, mangaID)
+		query += fmt.Sprintf(" AND v.manga_id = $%d", len(args))
+	}
+	query += " ORDER BY 3, v.volume_number NULLS LAST, v.id"
+
+	var writer exportWriter
+	var contentType, extension string
+	switch c.DefaultQuery("format", "csv") {
+	case "csv":
+		writer, contentType, extension = &csvExportWriter{w: csv.NewWriter(c.Writer)}, "text/csv; charset=utf-8", "csv"
+	case "goodreads":
+		writer, contentType, extension = &goodreadsExportWriter{w: csv.NewWriter(c.Writer)}, "text/csv; charset=utf-8", "csv"
+	case "json":
+		writer, contentType, extension = &jsonExportWriter{c: c}, "application/json; charset=utf-8", "json"
+	case "print":
+		writer, contentType, extension = &printExportWriter{c: c}, "text/html; charset=utf-8", ""
+	default:
+		c.JSON(400, gin.H{"error": "Invalid format"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(c.Request.Context(), query, args...)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to export collection"})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", contentType)
+	if extension != "" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="mangacollect-%s.%s"`, mangaType, extension))
+	}
+	c.Status(200)
+
+	// Headers are already sent from here on, so failures can only be logged.
+	if err := writer.begin(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	count := 0
+	for rows.Next() {
+		var row ExportRow
+		var volumeNumber sql.NullInt64
+		var isbn13, isbn10, publisher sql.NullString
+		err := rows.Scan(&row.VolumeID, &row.MangaID, &row.SeriesTitle, &row.Authors,
+			&row.VolumeTitle, &volumeNumber, &isbn13, &isbn10, &publisher,
+			&row.Status, &row.AddedAt)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if volumeNumber.Valid {
+			n := int(volumeNumber.Int64)
+			row.VolumeNumber = &n
+		}
+		row.ISBN13, row.ISBN10, row.Publisher = isbn13.String, isbn10.String, publisher.String
+
+		if err := writer.write(row); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			writer.flush()
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := writer.end(); err != nil {
+		fmt.Println(err)
+	}
+}
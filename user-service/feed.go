@@ -0,0 +1,292 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+var feedEventTypes = []string{"collection_add", "series_completed", "submission_approved"}
+
+func validFeedEventType(eventType string) bool {
+	for _, t := range feedEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// recordCollectionActivity turns the events of a committed batch into feed
+// entries: one collection_add per series that gained collected volumes, and
+// a series_completed the first time a batch leaves every volume of one of
+// its editions collected, once the series has finished publishing.
+func recordCollectionActivity(tx *sql.Tx, userID int, batchID string) error {
+	rows, err := tx.Query(`
+		INSERT INTO activity_events (user_id, event_type, manga_id, volume_ids, batch_id)
+		SELECT e.user_id, 'collection_add', v.manga_id, array_agg(e.manga_volume_id ORDER BY e.manga_volume_id), e.batch_id
+		FROM user_manga_events e
+		JOIN volumes v ON v.id = e.manga_volume_id
+		WHERE e.user_id = $1 AND e.batch_id = $2
+		AND e.new_status = 'collected' AND e.old_status IS DISTINCT FROM 'collected'
+		GROUP BY e.user_id, v.manga_id, e.batch_id
+		RETURNING manga_id
+	`, userID, batchID)
+	if err != nil {
+		return err
+	}
+	var mangaIDs []int
+	for rows.Next() {
+		var mangaID int
+		if err := rows.Scan(&mangaID); err != nil {
+			rows.Close()
+			return err
+		}
+		mangaIDs = append(mangaIDs, mangaID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(mangaIDs) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO activity_events (user_id, event_type, manga_id, batch_id)
+		SELECT $1, 'series_completed', m.id, $2
+		FROM unnest($3::int[]) AS m(id)
+		WHERE EXISTS (SELECT 1 FROM manga WHERE manga.id = m.id AND manga.status = 'FINISHED')
+		AND EXISTS (
+			SELECT 1 FROM editions ed
+			WHERE ed.manga_id = m.id
+			AND EXISTS (SELECT 1 FROM volumes v WHERE v.edition_id = ed.id)
+			AND NOT EXISTS (
+				SELECT 1 FROM volumes v
+				LEFT JOIN user_manga um ON um.manga_volume_id = v.id AND um.user_id = $1
+				WHERE v.edition_id = ed.id AND um.status IS DISTINCT FROM 'collected'
+			)
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM activity_events a
+			WHERE a.user_id = $1 AND a.event_type = 'series_completed' AND a.manga_id = m.id
+		)
+	`, userID, batchID, pq.Array(mangaIDs))
+	return err
+}
+
+// retractCollectionActivity takes undone volumes back out of the feed
+// entries of the batches they came from. Entries left without volumes are
+// dropped, as are completions of the affected series.
+func retractCollectionActivity(tx *sql.Tx, userID int, eventIDs []int64) error {
+	_, err := tx.Exec(`
+		UPDATE activity_events a
+		SET volume_ids = ARRAY(
+			SELECT id FROM unnest(a.volume_ids) AS id
+			WHERE id <> ALL (SELECT e.manga_volume_id FROM user_manga_events e WHERE e.id = ANY($2))
+		)
+		WHERE a.user_id = $1 AND a.event_type = 'collection_add'
+		AND a.batch_id IN (SELECT e.batch_id FROM user_manga_events e WHERE e.id = ANY($2))
+	`, userID, pq.Array(eventIDs))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM activity_events a
+		WHERE a.user_id = $1
+		AND a.batch_id IN (SELECT e.batch_id FROM user_manga_events e WHERE e.id = ANY($2))
+		AND (
+			(a.event_type = 'collection_add' AND cardinality(a.volume_ids) = 0)
+			OR (a.event_type = 'series_completed' AND a.manga_id IN (
+				SELECT v.manga_id FROM user_manga_events e
+				JOIN volumes v ON v.id = e.manga_volume_id
+				WHERE e.id = ANY($2)))
+		)
+	`, userID, pq.Array(eventIDs))
+	return err
+}
+
+type FeedEvent struct {
+	ID           int64     `json:"id"`
+	UserID       int       `json:"user_id"`
+	Username     string    `json:"username"`
+	EventType    string    `json:"event_type"`
+	MangaID      *int      `json:"manga_id"`
+	MangaTitle   *string   `json:"manga_title"`
+	VolumeIDs    []int64   `json:"volume_ids"`
+	VolumeCount  int       `json:"volume_count"`
+	SubmissionID *int      `json:"submission_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// getFeed lists activity of the users the caller follows, newest first,
+// without muted event types. Collection activity is only shown when the
+// followee's collection is visible to the caller. Page with ?before=<id>.
+func getFeed(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	before, err := strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid before"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`
+		SELECT a.id, a.user_id, u.username, a.event_type, a.manga_id,
+		       COALESCE(m.title_english, m.title_romaji), a.volume_ids, a.submission_id, a.created_at
+		FROM activity_events a
+		JOIN user_follows f ON f.followee_id = a.user_id AND f.follower_id = $1 AND f.approved
+		JOIN users u ON u.id = a.user_id
+		LEFT JOIN manga m ON m.id = a.manga_id
+		LEFT JOIN user_privacy_settings ps ON ps.user_id = a.user_id
+		WHERE ($2 = 0 OR a.id < $2)
+		AND `+visibilityCondition("ps.profile_visibility", "a.user_id", "$1")+`
+		AND (a.event_type = 'submission_approved' OR `+visibilityCondition("ps.collection_visibility", "a.user_id", "$1")+`)
+		AND NOT EXISTS (SELECT 1 FROM feed_mutes fm WHERE fm.user_id = $1 AND fm.event_type = a.event_type)
+		ORDER BY a.id DESC
+		LIMIT $3
+	`, userID, before, limit+1)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get feed"})
+		return
+	}
+	defer rows.Close()
+
+	events := []FeedEvent{}
+	for rows.Next() {
+		var e FeedEvent
+		var volumeIDs pq.Int64Array
+		err := rows.Scan(&e.ID, &e.UserID, &e.Username, &e.EventType, &e.MangaID,
+			&e.MangaTitle, &volumeIDs, &e.SubmissionID, &e.CreatedAt)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		e.VolumeIDs = []int64(volumeIDs)
+		if e.VolumeIDs == nil {
+			e.VolumeIDs = []int64{}
+		}
+		e.VolumeCount = len(e.VolumeIDs)
+		events = append(events, e)
+	}
+
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+
+	c.JSON(200, gin.H{"events": events, "hasMore": hasMore})
+}
+
+func getFeedMutes(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`SELECT event_type FROM feed_mutes WHERE user_id = $1 ORDER BY event_type`, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get muted event types"})
+		return
+	}
+	defer rows.Close()
+
+	muted := []string{}
+	for rows.Next() {
+		var eventType string
+		if err := rows.Scan(&eventType); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		muted = append(muted, eventType)
+	}
+
+	c.JSON(200, gin.H{"muted": muted, "event_types": feedEventTypes})
+}
+
+func muteFeedEventType(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	eventType := c.Param("event_type")
+	if !validFeedEventType(eventType) {
+		c.JSON(400, gin.H{"error": "Invalid event type"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(`INSERT INTO feed_mutes (user_id, event_type) VALUES ($1, $2)
+		ON CONFLICT (user_id, event_type) DO NOTHING`, userID, eventType)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to mute event type"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
+
+func unmuteFeedEventType(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	eventType := c.Param("event_type")
+	if !validFeedEventType(eventType) {
+		c.JSON(400, gin.H{"error": "Invalid event type"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(`DELETE FROM feed_mutes WHERE user_id = $1 AND event_type = $2`, userID, eventType)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unmute event type"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
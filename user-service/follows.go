@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+type FollowUser struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// followUser follows straight away when the followee doesn't need to approve
+// followers (see followsNeedApproval). Otherwise it leaves a pending request
+// the followee has to accept.
+func followUser(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	followeeID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if followeeID == userID {
+		c.JSON(400, gin.H{"error": "You can't follow yourself"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	if _, ok := getUsernameByID(conn, followeeID); !ok {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	settings, err := loadPrivacySettings(conn, followeeID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+		return
+	}
+	approved := !settings.followsNeedApproval()
+
+	// Re-following keeps an existing follow as it is.
+	err = conn.QueryRow(`INSERT INTO user_follows (follower_id, followee_id, approved)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (follower_id, followee_id) DO UPDATE SET approved = user_follows.approved
+		RETURNING approved`, userID, followeeID, approved).Scan(&approved)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to follow user"})
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true, "follow_status": followStatus(true, approved)})
+}
+
+// unfollowUser also cancels a pending request.
+func unfollowUser(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	followeeID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := conn.Exec(`DELETE FROM user_follows WHERE follower_id = $1 AND followee_id = $2`, userID, followeeID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unfollow user"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "You don't follow this user"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
+
+func followStatus(exists bool, approved bool) string {
+	switch {
+	case !exists:
+		return "none"
+	case !approved:
+		return "requested"
+	}
+	return "following"
+}
+
+// getFollowRequests lists the pending requests to follow the caller.
+func getFollowRequests(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`
+		SELECT u.id, u.username, f.created_at
+		FROM user_follows f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.followee_id = $1 AND NOT f.approved
+		ORDER BY f.created_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get follow requests"})
+		return
+	}
+	defer rows.Close()
+
+	requests := []FollowUser{}
+	for rows.Next() {
+		var f FollowUser
+		if err := rows.Scan(&f.UserID, &f.Username, &f.CreatedAt); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		requests = append(requests, f)
+	}
+
+	c.JSON(200, gin.H{"requests": requests})
+}
+
+func acceptFollowRequest(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	followerID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := conn.Exec(`UPDATE user_follows SET approved = TRUE
+		WHERE follower_id = $1 AND followee_id = $2 AND NOT approved`, followerID, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to accept follow request"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "Follow request not found"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
+
+// removeFollower declines a pending request or removes an existing follower.
+func removeFollower(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	followerID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := conn.Exec(`DELETE FROM user_follows WHERE follower_id = $1 AND followee_id = $2`, followerID, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to remove follower"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "This user doesn't follow you"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
+
+// listFollows serves both /:user_id/followers and /:user_id/following. Only
+// approved follows are listed, and only to viewers who can see the profile.
+func listFollows(direction string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		godotenv.Load()
+		userID, ok := getUserIDFromCookie(c)
+		if !ok {
+			return
+		}
+
+		requestedUserID, err := strconv.Atoi(c.Param("user_id"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		conn, err := get_db_conn()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "DB error"})
+			return
+		}
+		defer conn.Close()
+
+		username, ok := getUsernameByID(conn, requestedUserID)
+		if !ok {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		}
+
+		access, err := resolveProfileAccess(conn, userID, requestedUserID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+			return
+		}
+		if !access.Profile {
+			c.JSON(403, gin.H{"error": "This profile is private", "username": username})
+			return
+		}
+
+		// followers: who follows the user, following: who the user follows
+		ownCol, otherCol := "f.followee_id", "f.follower_id"
+		if direction == "following" {
+			ownCol, otherCol = "f.follower_id", "f.followee_id"
+		}
+
+		rows, err := conn.Query(`
+			SELECT u.id, u.username, f.created_at
+			FROM user_follows f
+			JOIN users u ON u.id = `+otherCol+`
+			WHERE `+ownCol+` = $1 AND f.approved
+			ORDER BY f.created_at DESC
+		`, requestedUserID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to get " + direction})
+			return
+		}
+		defer rows.Close()
+
+		users := []FollowUser{}
+		for rows.Next() {
+			var f FollowUser
+			if err := rows.Scan(&f.UserID, &f.Username, &f.CreatedAt); err != nil {
+				c.JSON(500, gin.H{"error": "Failed to scan row"})
+				return
+			}
+			users = append(users, f)
+		}
+
+		c.JSON(200, gin.H{direction: users, "username": username, "isOwner": userID == requestedUserID})
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const (
+	maxImportFileSize = 5 << 20 // 5 MB
+	maxImportRows     = 5000
+
+	// Fuzzy title matches below importMinSimilarity are not considered at all.
+	// A title match only counts as a confident match when it clears
+	// importMatchSimilarity and beats the runner-up by importMatchMargin.
+	importMinSimilarity   = 0.3
+	importMatchSimilarity = 0.6
+	importMatchMargin     = 0.1
+)
+
+// The parsers return errTooManyImportRows as soon as a file goes over
+// maxImportRows.
+var errTooManyImportRows = errors.New("too many import rows")
+
+var volumeNumberPattern = regexp.MustCompile(`(?i)[,:(\s]*\bvol(?:ume)?\.?\s*(\d+)`)
+
+// A single entry from an import file, normalized across formats.
+type importRow struct {
+	Line         int        `json:"line"`
+	ISBN         string     `json:"isbn,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	VolumeNumber int        `json:"volume_number,omitempty"`
+	Status       string     `json:"status"`
+	AddedAt      *time.Time `json:"added_at,omitempty"`
+}
+
+type importCandidate struct {
+	VolumeID     int     `json:"volume_id"`
+	MangaID      int     `json:"manga_id"`
+	Title        string  `json:"title"`
+	VolumeNumber *int    `json:"volume_number"`
+	Similarity   float64 `json:"similarity"`
+}
+
+type importResult struct {
+	Row        importRow         `json:"row"`
+	Match      *importCandidate  `json:"match,omitempty"`
+	Candidates []importCandidate `json:"candidates,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+}
+
+type ImportReport struct {
+	Format    string         `json:"format"`
+	DryRun    bool           `json:"dry_run"`
+	Imported  int            `json:"imported"`
+	BatchID   string         `json:"batch_id,omitempty"`
+	Matched   []importResult `json:"matched"`
+	Ambiguous []importResult `json:"ambiguous"`
+	Unmatched []importResult `json:"unmatched"`
+}
+
+// cleanISBN strips hyphens, spaces and spreadsheet quoting (Goodreads wraps
+// ISBNs as ="...") leaving only digits and a trailing X.
+func cleanISBN(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(raw) {
+		if (r >= '0' && r <= '9') || r == 'X' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// splitVolumeTitle pulls a volume number out of titles like
+// "Naruto, Vol. 1: Uzumaki Naruto" and returns the series part before it.
+func splitVolumeTitle(title string) (string, int) {
+	loc := volumeNumberPattern.FindStringSubmatchIndex(title)
+	if loc == nil {
+		return strings.TrimSpace(title), 0
+	}
+	number, _ := strconv.Atoi(title[loc[2]:loc[3]])
+	return strings.TrimSpace(title[:loc[0]]), number
+}
+
+func normalizeImportStatus(raw string, fallback string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "collected", "collection", "owned":
+		return "collected"
+	case "wishlisted", "wishlist", "wanted":
+		return "wishlisted"
+	}
+	return fallback
+}
+
+func readCSVRecords(r io.Reader) ([]string, [][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("file is empty")
+	}
+
+	header := make([]string, len(records[0]))
+	for i, h := range records[0] {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	}
+	return header, records[1:], nil
+}
+
+func csvField(header []string, record []string, names ...string) string {
+	for _, name := range names {
+		for i, h := range header {
+			if h == name && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+	}
+	return ""
+}
+
+// parseCSVImport reads our own CSV layout: a header row with isbn and/or
+// title + volume_number columns, and an optional status column.
+func parseCSVImport(r io.Reader, defaultStatus string) ([]importRow, error) {
+	header, records, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []importRow
+	for i, record := range records {
+		row := importRow{
+			Line:   i + 2,
+			ISBN:   cleanISBN(csvField(header, record, "isbn", "isbn_13", "isbn13", "isbn_10", "isbn10")),
+			Title:  csvField(header, record, "title", "series"),
+			Status: normalizeImportStatus(csvField(header, record, "status"), defaultStatus),
+		}
+		row.VolumeNumber, _ = strconv.Atoi(csvField(header, record, "volume_number", "volume", "vol"))
+		if row.VolumeNumber == 0 && row.Title != "" {
+			row.Title, row.VolumeNumber = splitVolumeTitle(row.Title)
+		}
+		if row.ISBN == "" && row.Title == "" {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, errTooManyImportRows
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseGoodreadsImport reads a Goodreads library export. Books on the
+// to-read shelf become wishlist entries, everything else is collected.
+func parseGoodreadsImport(r io.Reader) ([]importRow, error) {
+	header, records, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []importRow
+	for i, record := range records {
+		isbn := cleanISBN(csvField(header, record, "isbn13"))
+		if isbn == "" {
+			isbn = cleanISBN(csvField(header, record, "isbn"))
+		}
+
+		status := "collected"
+		if csvField(header, record, "exclusive shelf") == "to-read" {
+			status = "wishlisted"
+		}
+
+		row := importRow{Line: i + 2, ISBN: isbn, Status: status}
+		row.Title, row.VolumeNumber = splitVolumeTitle(csvField(header, record, "title"))
+
+		if added, err := time.Parse("2006/01/02", csvField(header, record, "date added")); err == nil {
+			row.AddedAt = &added
+		}
+		if row.ISBN == "" && row.Title == "" {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, errTooManyImportRows
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseMALImport reads a MyAnimeList manga list export. MAL tracks series
+// rather than books, so each entry expands to volumes 1..my_read_volumes.
+func parseMALImport(r io.Reader, defaultStatus string) ([]importRow, []importResult, error) {
+	type malExport struct {
+		Manga []struct {
+			Title       string `xml:"manga_title"`
+			SeriesTitle string `xml:"series_title"`
+			ReadVolumes int    `xml:"my_read_volumes"`
+			Status      string `xml:"my_status"`
+		} `xml:"manga"`
+	}
+
+	var export malExport
+	if err := xml.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, err
+	}
+
+	var rows []importRow
+	var skipped []importResult
+	for i, entry := range export.Manga {
+		title := strings.TrimSpace(entry.SeriesTitle)
+		if title == "" {
+			title = strings.TrimSpace(entry.Title)
+		}
+
+		status := defaultStatus
+		if entry.Status == "Plan to Read" {
+			status = "wishlisted"
+		}
+
+		if entry.ReadVolumes <= 0 {
+			skipped = append(skipped, importResult{
+				Row:    importRow{Line: i + 1, Title: title, Status: status},
+				Reason: "No volumes recorded for this series",
+			})
+			continue
+		}
+		// Checked before expanding: my_read_volumes comes straight from the
+		// uploaded file.
+		if entry.ReadVolumes > maxImportRows-len(rows) {
+			return nil, nil, errTooManyImportRows
+		}
+		for n := 1; n <= entry.ReadVolumes; n++ {
+			rows = append(rows, importRow{Line: i + 1, Title: title, VolumeNumber: n, Status: status})
+		}
+	}
+	return rows, skipped, nil
+}
+
+func scanImportCandidates(rows *sql.Rows) ([]importCandidate, error) {
+	defer rows.Close()
+
+	var candidates []importCandidate
+	for rows.Next() {
+		var cand importCandidate
+		var volumeNumber sql.NullInt64
+		if err := rows.Scan(&cand.VolumeID, &cand.MangaID, &cand.Title, &volumeNumber, &cand.Similarity); err != nil {
+			return nil, err
+		}
+		if volumeNumber.Valid {
+			n := int(volumeNumber.Int64)
+			cand.VolumeNumber = &n
+		}
+		candidates = append(candidates, cand)
+	}
+	return candidates, rows.Err()
+}
+
+// findImportCandidates looks a row up by ISBN first and falls back to
+// trigram similarity on the series title (or the volume title when the row
+// has no volume number).
+func findImportCandidates(conn *sql.DB, row importRow) ([]importCandidate, error) {
+	if row.ISBN != "" {
+		// Match on both forms of valid ISBNs; anything else is compared as-is.
+		isbn13, isbn10, err := normalizeISBN(row.ISBN)
+		if err != nil {
+			isbn13, isbn10 = row.ISBN, row.ISBN
+		}
+		rows, err := conn.Query(`
+			SELECT v.id, v.manga_id, v.title, v.volume_number, 1.0
+			FROM volumes v
+			WHERE v.isbn_13 = $1 OR v.isbn_10 = NULLIF($2, '')
+		`, isbn13, isbn10)
+		if err != nil {
+			return nil, err
+		}
+		candidates, err := scanImportCandidates(rows)
+		if err != nil || len(candidates) > 0 || row.Title == "" {
+			return candidates, err
+		}
+	}
+
+	if row.Title == "" {
+		return nil, nil
+	}
+
+	var rows *sql.Rows
+	var err error
+	if row.VolumeNumber > 0 {
+		rows, err = conn.Query(`
+			SELECT v.id, v.manga_id, v.title, v.volume_number,
+			       GREATEST(similarity(COALESCE(m.title_english, ''), $1),
+			                similarity(COALESCE(m.title_romaji, ''), $1)) AS sim
+			FROM volumes v
+			JOIN manga m ON m.id = v.manga_id
+			WHERE v.volume_number = $2
+			AND GREATEST(similarity(COALESCE(m.title_english, ''), $1),
+			             similarity(COALESCE(m.title_romaji, ''), $1)) > $3
+			ORDER BY sim DESC
+			LIMIT 5
+		`, row.Title, row.VolumeNumber, importMinSimilarity)
+	} else {
+		rows, err = conn.Query(`
+			SELECT v.id, v.manga_id, v.title, v.volume_number, similarity(v.title, $1) AS sim
+			FROM volumes v
+			WHERE similarity(v.title, $1) > $2
+			ORDER BY sim DESC
+			LIMIT 5
+		`, row.Title, importMinSimilarity)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanImportCandidates(rows)
+}
+
+// classifyImportRow decides whether the candidates amount to a single match.
+func classifyImportRow(row importRow, candidates []importCandidate) (importResult, string) {
+	result := importResult{Row: row}
+
+	switch {
+	case len(candidates) == 0:
+		result.Reason = "No matching volume found"
+		return result, "unmatched"
+	case len(candidates) == 1 && candidates[0].Similarity >= importMatchSimilarity:
+		result.Match = &candidates[0]
+		return result, "matched"
+	case len(candidates) > 1 &&
+		candidates[0].Similarity >= importMatchSimilarity &&
+		candidates[0].Similarity-candidates[1].Similarity >= importMatchMargin:
+		result.Match = &candidates[0]
+		return result, "matched"
+	}
+
+	result.Candidates = candidates
+	result.Reason = "Several volumes could match this row"
+	if len(candidates) == 1 {
+		result.Reason = "Closest volume is not a confident match"
+	}
+	return result, "ambiguous"
+}
+
+// importCollection matches an uploaded file against volumes and reports the
+// result. Nothing is written unless commit=true, in which case only the
+// matched rows are upserted into user_manga.
+func importCollection(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+
+	format := strings.ToLower(c.DefaultPostForm("format", "csv"))
+	defaultStatus := normalizeImportStatus(c.DefaultPostForm("status", "collected"), "")
+	if defaultStatus == "" {
+		c.JSON(400, gin.H{"error": "Invalid status"})
+		return
+	}
+	commit := c.PostForm("commit") == "true"
+
+	report := ImportReport{
+		Format:    format,
+		DryRun:    !commit,
+		Matched:   []importResult{},
+		Ambiguous: []importResult{},
+		Unmatched: []importResult{},
+	}
+
+	var rows []importRow
+	switch format {
+	case "csv":
+		rows, err = parseCSVImport(file, defaultStatus)
+	case "goodreads":
+		rows, err = parseGoodreadsImport(file)
+	case "mal":
+		var skipped []importResult
+		rows, skipped, err = parseMALImport(file, defaultStatus)
+		report.Unmatched = append(report.Unmatched, skipped...)
+	default:
+		c.JSON(400, gin.H{"error": "Invalid format"})
+		return
+	}
+	if errors.Is(err, errTooManyImportRows) {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Import files are limited to %d rows", maxImportRows)})
+		return
+	}
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Could not parse import file"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	for _, row := range rows {
+		candidates, err := findImportCandidates(conn, row)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(500, gin.H{"error": "Failed to match import rows"})
+			return
+		}
+
+		result, category := classifyImportRow(row, candidates)
+		switch category {
+		case "matched":
+			report.Matched = append(report.Matched, result)
+		case "ambiguous":
+			report.Ambiguous = append(report.Ambiguous, result)
+		default:
+			report.Unmatched = append(report.Unmatched, result)
+		}
+	}
+
+	if !commit {
+		c.JSON(200, report)
+		return
+	}
+
+	volumeIDs := make([]int, 0, len(report.Matched))
+	for _, result := range report.Matched {
+		volumeIDs = append(volumeIDs, result.Match.VolumeID)
+	}
+
+	// Re-importing a volume with the same status keeps its original added_at.
+	batchID, err := applyCollectionChange(conn, userID, "import", volumeIDs, func(tx *sql.Tx) error {
+		for _, result := range report.Matched {
+			var addedAt sql.NullTime
+			if result.Row.AddedAt != nil {
+				addedAt = sql.NullTime{Time: *result.Row.AddedAt, Valid: true}
+			}
+			_, err := tx.Exec(`INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
+				VALUES ($1, $2, $3, COALESCE($4, NOW()))
+				ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET
+					status = EXCLUDED.status,
+					added_at = CASE WHEN user_manga.status = EXCLUDED.status
+						THEN user_manga.added_at ELSE EXCLUDED.added_at END`,
+				userID, result.Match.VolumeID, result.Row.Status, addedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to import collection"})
+		return
+	}
+	report.Imported = len(report.Matched)
+	report.BatchID = batchID
+
+	c.JSON(200, report)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+var errInvalidISBN = errors.New("invalid ISBN")
+
+func isbn10CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(digits[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+func isbn13CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(digits[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func allDigits(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// normalizeISBN validates a scanned ISBN-10 or ISBN-13 (hyphens and spaces
+// allowed) and returns both forms. isbn10 is empty for 979-prefixed codes,
+// which have no ISBN-10 equivalent.
+func normalizeISBN(raw string) (isbn13 string, isbn10 string, err error) {
+	code := cleanISBN(raw)
+
+	switch len(code) {
+	case 10:
+		if !allDigits(code[:9]) || isbn10CheckDigit(code) != code[9] {
+			return "", "", errInvalidISBN
+		}
+		isbn10 = code
+		isbn13 = "978" + code[:9]
+		isbn13 += string(isbn13CheckDigit(isbn13))
+		return isbn13, isbn10, nil
+	case 13:
+		if !allDigits(code) || isbn13CheckDigit(code) != code[12] {
+			return "", "", errInvalidISBN
+		}
+		isbn13 = code
+		if code[:3] == "978" {
+			isbn10 = code[3:12]
+			isbn10 += string(isbn10CheckDigit(isbn10))
+		}
+		return isbn13, isbn10, nil
+	}
+	return "", "", errInvalidISBN
+}
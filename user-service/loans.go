@@ -0,0 +1,835 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+const (
+	// A lender can nudge a borrower at most once per interval.
+	loanReminderInterval = 24 * time.Hour
+	// Loans due within this many days show up in the borrower's reminders.
+	loanDueSoonDays = 3
+)
+
+var errLoanNotFound = errors.New("loan not found")
+
+type LoanItem struct {
+	OwnerID     int    `json:"owner_id"`
+	VolumeID    int    `json:"volume_id"`
+	VolumeTitle string `json:"volume_title"`
+	MangaID     int    `json:"manga_id"`
+}
+
+type Loan struct {
+	ID             int        `json:"id"`
+	Kind           string     `json:"kind"`
+	ProposerID     int        `json:"proposer_id"`
+	ProposerName   string     `json:"proposer_username"`
+	RecipientID    int        `json:"recipient_id"`
+	RecipientName  string     `json:"recipient_username"`
+	Status         string     `json:"status"`
+	DueDate        *string    `json:"due_date"`
+	Overdue        bool       `json:"overdue"`
+	Note           *string    `json:"note"`
+	ReminderCount  int        `json:"reminder_count"`
+	LastRemindedAt *time.Time `json:"last_reminded_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RespondedAt    *time.Time `json:"responded_at"`
+	ReturnedAt     *time.Time `json:"returned_at"`
+	Items          []LoanItem `json:"items"`
+}
+
+// Shown on a collection volume while it is out on loan.
+type LentTo struct {
+	LoanID   int     `json:"loan_id"`
+	UserID   int     `json:"user_id"`
+	Username string  `json:"username"`
+	DueDate  *string `json:"due_date"`
+}
+
+// loadLoans returns the loans matching where (written against loans l) with
+// their items, newest first.
+func loadLoans(conn *sql.DB, where string, args ...any) ([]Loan, error) {
+	rows, err := conn.Query(`
+		SELECT l.id, l.kind, l.proposer_id, p.username, l.recipient_id, r.username, l.status,
+		       to_char(l.due_date, 'YYYY-MM-DD'),
+		       l.status = 'accepted' AND l.due_date IS NOT NULL AND l.due_date < CURRENT_DATE,
+		       l.note, l.reminder_count, l.last_reminded_at, l.created_at, l.responded_at, l.returned_at
+		FROM loans l
+		JOIN users p ON p.id = l.proposer_id
+		JOIN users r ON r.id = l.recipient_id
+		WHERE `+where+`
+		ORDER BY l.created_at DESC, l.id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loans := []Loan{}
+	index := make(map[int]int)
+	var ids []int
+	for rows.Next() {
+		var l Loan
+		err := rows.Scan(&l.ID, &l.Kind, &l.ProposerID, &l.ProposerName, &l.RecipientID, &l.RecipientName, &l.Status,
+			&l.DueDate, &l.Overdue, &l.Note, &l.ReminderCount, &l.LastRemindedAt, &l.CreatedAt, &l.RespondedAt, &l.ReturnedAt)
+		if err != nil {
+			return nil, err
+		}
+		l.Items = []LoanItem{}
+		index[l.ID] = len(loans)
+		ids = append(ids, l.ID)
+		loans = append(loans, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return loans, nil
+	}
+
+	itemRows, err := conn.Query(`
+		SELECT li.loan_id, li.owner_id, v.id, v.title, v.manga_id
+		FROM loan_items li
+		JOIN volumes v ON v.id = li.manga_volume_id
+		WHERE li.loan_id = ANY($1)
+		ORDER BY li.loan_id, v.manga_id, v.volume_number NULLS LAST, v.id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var loanID int
+		var item LoanItem
+		if err := itemRows.Scan(&loanID, &item.OwnerID, &item.VolumeID, &item.VolumeTitle, &item.MangaID); err != nil {
+			return nil, err
+		}
+		l := &loans[index[loanID]]
+		l.Items = append(l.Items, item)
+	}
+	return loans, itemRows.Err()
+}
+
+// loadLentVolumes maps each of the owner's volumes that is out on loan to
+// who has it.
+func loadLentVolumes(conn *sql.DB, ownerID int) (map[int]*LentTo, error) {
+	rows, err := conn.Query(`
+		SELECT li.manga_volume_id, l.id, l.recipient_id, u.username, to_char(l.due_date, 'YYYY-MM-DD')
+		FROM loan_items li
+		JOIN loans l ON l.id = li.loan_id
+		JOIN users u ON u.id = l.recipient_id
+		WHERE li.owner_id = $1 AND l.kind = 'loan' AND l.status = 'accepted'
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lent := make(map[int]*LentTo)
+	for rows.Next() {
+		var volumeID int
+		var l LentTo
+		if err := rows.Scan(&volumeID, &l.LoanID, &l.UserID, &l.Username, &l.DueDate); err != nil {
+			return nil, err
+		}
+		lent[volumeID] = &l
+	}
+	return lent, rows.Err()
+}
+
+// onLoan matches volume t.vid of owner $1 while it is out on an accepted
+// loan, for queries over unnest($2::int[]) AS t(vid). The column is
+// qualified because a bare id would resolve to loans.id.
+const onLoan = `EXISTS (
+	SELECT 1 FROM loan_items li
+	JOIN loans l ON l.id = li.loan_id
+	WHERE li.owner_id = $1 AND li.manga_volume_id = t.vid AND l.kind = 'loan' AND l.status = 'accepted'
+)`
+
+// unavailableVolumes returns the volumes the owner can't lend or trade right
+// now: ones not in their collection and ones already out on loan.
+func unavailableVolumes(tx *sql.Tx, ownerID int, volumeIDs []int) ([]int, error) {
+	return selectVolumeIDs(tx, `
+		SELECT t.vid FROM unnest($2::int[]) AS t(vid)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM user_manga um
+			WHERE um.user_id = $1 AND um.manga_volume_id = t.vid AND um.status = 'collected'
+		)
+		OR `+onLoan+`
+		ORDER BY t.vid
+	`, ownerID, volumeIDs)
+}
+
+// lentOutVolumes returns the volumes the owner has lent to someone and not
+// got back yet. They stay in the collection until returned.
+func lentOutVolumes(tx *sql.Tx, ownerID int, volumeIDs []int) ([]int, error) {
+	return selectVolumeIDs(tx, `
+		SELECT t.vid FROM unnest($2::int[]) AS t(vid)
+		WHERE `+onLoan+`
+		ORDER BY t.vid
+	`, ownerID, volumeIDs)
+}
+
+// lentOutError aborts a collection change that would take lent volumes out
+// of the collection.
+type lentOutError struct {
+	volumeIDs []int
+}
+
+func (e *lentOutError) Error() string {
+	return fmt.Sprintf("volumes %v are lent out", e.volumeIDs)
+}
+
+// checkNotLentOut returns a lentOutError if any of volumeIDs is lent out.
+func checkNotLentOut(tx *sql.Tx, ownerID int, volumeIDs []int) error {
+	lent, err := lentOutVolumes(tx, ownerID, volumeIDs)
+	if err != nil {
+		return err
+	}
+	if len(lent) > 0 {
+		return &lentOutError{volumeIDs: lent}
+	}
+	return nil
+}
+
+// respondLentOut answers 409 when err is a lentOutError.
+func respondLentOut(c *gin.Context, err error) bool {
+	var lent *lentOutError
+	if !errors.As(err, &lent) {
+		return false
+	}
+	c.JSON(409, gin.H{"error": "Some volumes are lent out, mark them returned first", "volume_ids": lent.volumeIDs})
+	return true
+}
+
+func selectVolumeIDs(tx *sql.Tx, query string, ownerID int, volumeIDs []int) ([]int, error) {
+	rows, err := tx.Query(query, ownerID, pq.Array(volumeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unavailable := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		unavailable = append(unavailable, id)
+	}
+	return unavailable, rows.Err()
+}
+
+func uniqueInts(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// parseDueDate accepts YYYY-MM-DD dates from today on. An empty string means
+// no due date.
+func parseDueDate(raw string) (*string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, err
+	}
+	if date.Before(time.Now().Truncate(24 * time.Hour)) {
+		return nil, errors.New("due date is in the past")
+	}
+	return &raw, nil
+}
+
+// createLoan proposes lending the caller's volumes to another user, or for
+// trades, swapping them for some of that user's volumes.
+func createLoan(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	type LoanBody struct {
+		Kind               string `json:"kind"`
+		RecipientID        int    `json:"recipient_id"`
+		VolumeIDs          []int  `json:"volume_ids"`
+		RequestedVolumeIDs []int  `json:"requested_volume_ids"`
+		DueDate            string `json:"due_date"`
+		Note               string `json:"note"`
+	}
+
+	var body LoanBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	if body.Kind == "" {
+		body.Kind = "loan"
+	}
+	if body.Kind != "loan" && body.Kind != "trade" {
+		c.JSON(400, gin.H{"error": "Kind must be loan or trade"})
+		return
+	}
+	if body.RecipientID == userID {
+		c.JSON(400, gin.H{"error": "You can't lend to yourself"})
+		return
+	}
+
+	offered := uniqueInts(body.VolumeIDs)
+	requested := uniqueInts(body.RequestedVolumeIDs)
+	if len(offered) == 0 {
+		c.JSON(400, gin.H{"error": "Pick at least one of your volumes"})
+		return
+	}
+	if body.Kind == "loan" && len(requested) > 0 {
+		c.JSON(400, gin.H{"error": "Loans can't request volumes, propose a trade instead"})
+		return
+	}
+	if body.Kind == "trade" && len(requested) == 0 {
+		c.JSON(400, gin.H{"error": "Pick at least one volume to trade for"})
+		return
+	}
+	if body.Kind == "trade" && body.DueDate != "" {
+		c.JSON(400, gin.H{"error": "Trades don't have a due date"})
+		return
+	}
+	for _, id := range requested {
+		for _, other := range offered {
+			if id == other {
+				c.JSON(400, gin.H{"error": "A volume can't be on both sides of a trade"})
+				return
+			}
+		}
+	}
+
+	dueDate, err := parseDueDate(body.DueDate)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Due date must be a YYYY-MM-DD date from today on"})
+		return
+	}
+	var note *string
+	if strings.TrimSpace(body.Note) != "" {
+		note = &body.Note
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	if _, ok := getUsernameByID(conn, body.RecipientID); !ok {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Asking for volumes only makes sense if the proposer can see them.
+	if body.Kind == "trade" {
+		access, err := resolveProfileAccess(conn, userID, body.RecipientID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+			return
+		}
+		if !access.Collection {
+			c.JSON(403, gin.H{"error": "This collection is private"})
+			return
+		}
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	unavailable, err := unavailableVolumes(tx, userID, offered)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check volumes"})
+		return
+	}
+	if len(unavailable) > 0 {
+		c.JSON(409, gin.H{"error": "Some volumes aren't in your collection or are lent out", "volume_ids": unavailable})
+		return
+	}
+	if len(requested) > 0 {
+		unavailable, err = unavailableVolumes(tx, body.RecipientID, requested)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check volumes"})
+			return
+		}
+		if len(unavailable) > 0 {
+			c.JSON(409, gin.H{"error": "Some requested volumes aren't available", "volume_ids": unavailable})
+			return
+		}
+	}
+
+	var loanID int
+	err = tx.QueryRow(`INSERT INTO loans (kind, proposer_id, recipient_id, due_date, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, body.Kind, userID, body.RecipientID, dueDate, note).Scan(&loanID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	_, err = tx.Exec(`INSERT INTO loan_items (loan_id, owner_id, manga_volume_id)
+		SELECT $1, $2, id FROM unnest($3::int[]) AS id
+		UNION ALL
+		SELECT $1, $4, id FROM unnest($5::int[]) AS id`,
+		loanID, userID, pq.Array(offered), body.RecipientID, pq.Array(requested))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	rollback = false
+
+	respondLoan(c, conn, userID, loanID, gin.H{})
+}
+
+// respondLoan answers with the loan as the caller now sees it, merged into
+// extra.
+func respondLoan(c *gin.Context, conn *sql.DB, userID int, loanID int, extra gin.H) {
+	loans, err := loadLoans(conn, "l.id = $1 AND (l.proposer_id = $2 OR l.recipient_id = $2)", loanID, userID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get loan"})
+		return
+	}
+	if len(loans) == 0 {
+		c.JSON(404, gin.H{"error": "Loan not found"})
+		return
+	}
+	extra["loan"] = loans[0]
+	c.JSON(200, extra)
+}
+
+// getLoans lists the caller's loans and trades. role is sent (proposed by
+// the caller), received or all; status optionally filters by status.
+func getLoans(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	where := "(l.proposer_id = $1 OR l.recipient_id = $1)"
+	switch c.DefaultQuery("role", "all") {
+	case "sent":
+		where = "l.proposer_id = $1"
+	case "received":
+		where = "l.recipient_id = $1"
+	case "all":
+	default:
+		c.JSON(400, gin.H{"error": "Role must be sent, received or all"})
+		return
+	}
+	args := []any{userID}
+	if status, found := c.GetQuery("status"); found {
+		args = append(args, status)
+		where += " AND l.status = $2"
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	loans, err := loadLoans(conn, where, args...)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get loans"})
+		return
+	}
+	c.JSON(200, gin.H{"loans": loans})
+}
+
+func getLoan(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	loanID, err := strconv.Atoi(c.Param("loan_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	respondLoan(c, conn, userID, loanID, gin.H{})
+}
+
+// getLoanReminders lists what needs the caller's attention: loans they
+// borrowed that are overdue, due soon or that the lender has reminded them
+// of, and loans they lent that are overdue.
+func getLoanReminders(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	borrowed, err := loadLoans(conn, `l.recipient_id = $1 AND l.kind = 'loan' AND l.status = 'accepted'
+		AND (l.due_date <= CURRENT_DATE + $2::int OR l.last_reminded_at IS NOT NULL)`, userID, loanDueSoonDays)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get reminders"})
+		return
+	}
+	lent, err := loadLoans(conn, `l.proposer_id = $1 AND l.kind = 'loan' AND l.status = 'accepted'
+		AND l.due_date < CURRENT_DATE`, userID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get reminders"})
+		return
+	}
+
+	c.JSON(200, gin.H{"borrowed": borrowed, "lent": lent})
+}
+
+// lockLoan loads the loan for update and checks the caller's role in it and
+// its current status. A non-empty refusal explains why the caller can't act
+// on the loan right now.
+func lockLoan(tx *sql.Tx, loanID int, userID int, role string, kind string, statuses []string) (loanKind string, refusal string, err error) {
+	var proposerID, recipientID int
+	var status string
+	err = tx.QueryRow(`SELECT proposer_id, recipient_id, kind, status FROM loans WHERE id = $1 FOR UPDATE`, loanID).
+		Scan(&proposerID, &recipientID, &loanKind, &status)
+	if err == sql.ErrNoRows {
+		return "", "", errLoanNotFound
+	} else if err != nil {
+		return "", "", err
+	}
+
+	// Loans the caller isn't part of don't exist as far as they know.
+	if proposerID != userID && recipientID != userID {
+		return "", "", errLoanNotFound
+	}
+	if (role == "proposer" && proposerID != userID) || (role == "recipient" && recipientID != userID) {
+		return loanKind, fmt.Sprintf("Only the %s can do this", role), nil
+	}
+	if kind != "" && loanKind != kind {
+		return loanKind, fmt.Sprintf("Only %ss can do this", kind), nil
+	}
+	for _, s := range statuses {
+		if s == status {
+			return loanKind, "", nil
+		}
+	}
+	return loanKind, fmt.Sprintf("This %s is %s", loanKind, status), nil
+}
+
+// loanAction runs one state change on a loan. fn runs once lockLoan has let
+// the caller through and returns extra response fields, or false when it
+// already answered with an error.
+func loanAction(c *gin.Context, role string, kind string, statuses []string, fn func(tx *sql.Tx, userID int, loanID int, loanKind string) (gin.H, bool)) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	loanID, err := strconv.Atoi(c.Param("loan_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	loanKind, refusal, err := lockLoan(tx, loanID, userID, role, kind, statuses)
+	if errors.Is(err, errLoanNotFound) {
+		c.JSON(404, gin.H{"error": "Loan not found"})
+		return
+	} else if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to load loan"})
+		return
+	} else if refusal != "" {
+		c.JSON(409, gin.H{"error": refusal})
+		return
+	}
+
+	extra, ok := fn(tx, userID, loanID, loanKind)
+	if !ok {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	rollback = false
+
+	respondLoan(c, conn, userID, loanID, extra)
+}
+
+func loanItemsOf(tx *sql.Tx, loanID int, ownerID int) ([]int, error) {
+	rows, err := tx.Query(`SELECT manga_volume_id FROM loan_items WHERE loan_id = $1 AND owner_id = $2`, loanID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// tradeVolumes removes give from the user's collection and adds receive to
+// it, logged as one batch.
+func tradeVolumes(tx *sql.Tx, userID int, give []int, receive []int) (string, error) {
+	volumeIDs := make([]int, 0, len(give)+len(receive))
+	volumeIDs = append(volumeIDs, give...)
+	volumeIDs = append(volumeIDs, receive...)
+
+	return applyCollectionChangeTx(tx, userID, "trade", volumeIDs, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM user_manga WHERE user_id = $1 AND manga_volume_id = ANY($2)`, userID, pq.Array(give))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
+			SELECT $1, id, 'collected', NOW() FROM unnest($2::int[]) AS id
+			ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET
+				status = 'collected',
+				added_at = CASE WHEN user_manga.status = 'collected' THEN user_manga.added_at ELSE NOW() END`,
+			userID, pq.Array(receive))
+		return err
+	})
+}
+
+// acceptLoan starts a loan, or carries out a trade straight away by moving
+// the volumes between both collections.
+func acceptLoan(c *gin.Context) {
+	loanAction(c, "recipient", "", []string{"proposed"}, func(tx *sql.Tx, userID int, loanID int, kind string) (gin.H, bool) {
+		var proposerID int
+		if err := tx.QueryRow(`SELECT proposer_id FROM loans WHERE id = $1`, loanID).Scan(&proposerID); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to load loan"})
+			return nil, false
+		}
+
+		offered, err := loanItemsOf(tx, loanID, proposerID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to load loan"})
+			return nil, false
+		}
+		requested, err := loanItemsOf(tx, loanID, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to load loan"})
+			return nil, false
+		}
+
+		for _, side := range []struct {
+			ownerID   int
+			volumeIDs []int
+		}{{proposerID, offered}, {userID, requested}} {
+			if len(side.volumeIDs) == 0 {
+				continue
+			}
+			unavailable, err := unavailableVolumes(tx, side.ownerID, side.volumeIDs)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to check volumes"})
+				return nil, false
+			}
+			if len(unavailable) > 0 {
+				c.JSON(409, gin.H{"error": "Some volumes are no longer available", "volume_ids": unavailable})
+				return nil, false
+			}
+		}
+
+		extra := gin.H{"success": true}
+		status := "accepted"
+		if kind == "trade" {
+			status = "completed"
+			if _, err := tradeVolumes(tx, proposerID, offered, requested); err != nil {
+				fmt.Println(err)
+				c.JSON(500, gin.H{"error": "Failed to trade volumes"})
+				return nil, false
+			}
+			// Only the caller's side of the trade is theirs to undo.
+			batchID, err := tradeVolumes(tx, userID, requested, offered)
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(500, gin.H{"error": "Failed to trade volumes"})
+				return nil, false
+			}
+			extra["batch_id"] = batchID
+		}
+
+		_, err = tx.Exec(`UPDATE loans SET status = $2, responded_at = NOW() WHERE id = $1`, loanID, status)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to accept"})
+			return nil, false
+		}
+		return extra, true
+	})
+}
+
+func declineLoan(c *gin.Context) {
+	loanAction(c, "recipient", "", []string{"proposed"}, func(tx *sql.Tx, userID int, loanID int, kind string) (gin.H, bool) {
+		_, err := tx.Exec(`UPDATE loans SET status = 'declined', responded_at = NOW() WHERE id = $1`, loanID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to decline"})
+			return nil, false
+		}
+		return gin.H{"success": true}, true
+	})
+}
+
+func cancelLoan(c *gin.Context) {
+	loanAction(c, "proposer", "", []string{"proposed"}, func(tx *sql.Tx, userID int, loanID int, kind string) (gin.H, bool) {
+		_, err := tx.Exec(`UPDATE loans SET status = 'cancelled' WHERE id = $1`, loanID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to cancel"})
+			return nil, false
+		}
+		return gin.H{"success": true}, true
+	})
+}
+
+// returnLoan is the lender confirming they have their volumes back.
+func returnLoan(c *gin.Context) {
+	loanAction(c, "proposer", "loan", []string{"accepted"}, func(tx *sql.Tx, userID int, loanID int, kind string) (gin.H, bool) {
+		_, err := tx.Exec(`UPDATE loans SET status = 'returned', returned_at = NOW() WHERE id = $1`, loanID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to confirm return"})
+			return nil, false
+		}
+		return gin.H{"success": true}, true
+	})
+}
+
+// updateLoanDueDate lets the lender move or clear the due date.
+func updateLoanDueDate(c *gin.Context) {
+	type DueDateBody struct {
+		DueDate string `json:"due_date"`
+	}
+
+	var body DueDateBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	dueDate, err := parseDueDate(body.DueDate)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Due date must be a YYYY-MM-DD date from today on"})
+		return
+	}
+
+	loanAction(c, "proposer", "loan", []string{"proposed", "accepted"}, func(tx *sql.Tx, userID int, loanID int, kind string) (gin.H, bool) {
+		_, err := tx.Exec(`UPDATE loans SET due_date = $2, last_reminded_at = NULL WHERE id = $1`, loanID, dueDate)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update due date"})
+			return nil, false
+		}
+		return gin.H{"success": true}, true
+	})
+}
+
+// remindLoan records a reminder from the lender, which puts the loan in the
+// borrower's reminders and sends them a notification.
+func remindLoan(c *gin.Context) {
+	loanAction(c, "proposer", "loan", []string{"accepted"}, func(tx *sql.Tx, userID int, loanID int, kind string) (gin.H, bool) {
+		result, err := tx.Exec(`UPDATE loans SET reminder_count = reminder_count + 1, last_reminded_at = NOW()
+			WHERE id = $1 AND (last_reminded_at IS NULL OR last_reminded_at < NOW() - $2::interval)`,
+			loanID, fmt.Sprintf("%d seconds", int(loanReminderInterval.Seconds())))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to send reminder"})
+			return nil, false
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(429, gin.H{"error": "You already sent a reminder recently"})
+			return nil, false
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO notifications (user_id, type, data, dedupe_key)
+			SELECT l.recipient_id, 'loan_reminder',
+			       jsonb_build_object('loan_id', l.id, 'from', u.username, 'due_date', l.due_date),
+			       'loan_reminder:' || l.id || ':' || l.reminder_count
+			FROM loans l
+			JOIN users u ON u.id = l.proposer_id
+			LEFT JOIN notification_preferences np ON np.user_id = l.recipient_id
+			WHERE l.id = $1 AND COALESCE(np.loan_reminders, TRUE)
+			ON CONFLICT (user_id, dedupe_key) DO NOTHING
+		`, loanID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(500, gin.H{"error": "Failed to send reminder"})
+			return nil, false
+		}
+		return gin.H{"success": true}, true
+	})
+}
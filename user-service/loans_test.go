@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A lent volume stays in the lender's collection until it comes back, so
+// nothing may remove it, move it or lend it again in the meantime.
+func TestLentVolumeIsLocked(t *testing.T) {
+	conn := newTestDB(t)
+	router := gin.New()
+	router.POST("/loans", createLoan)
+	router.POST("/loans/:loan_id/accept", acceptLoan)
+	router.POST("/loans/:loan_id/return", returnLoan)
+	router.DELETE("/collection/:volume_id", deleteCollectionVolume)
+	router.POST("/wishlist/:volume_id", addToWishlist)
+	router.POST("/wishlist/manga/:manga_id", moveAllMangaToWishlist)
+
+	lender := seedUser(t, conn, "loan_lender")
+	borrower := seedUser(t, conn, "loan_borrower")
+	other := seedUser(t, conn, "loan_other")
+	mangaID := seedManga(t, conn, "Loan Test")
+	kept := seedVolume(t, conn, mangaID, 1)
+	lent := seedVolume(t, conn, mangaID, 2)
+	seedStatus(t, conn, lender, kept, "collected")
+	seedStatus(t, conn, lender, lent, "collected")
+	lenderCookie := authCookie(t, lender)
+
+	w := serve(router, http.MethodPost, "/loans",
+		fmt.Sprintf(`{"recipient_id": %d, "volume_ids": [%d]}`, borrower, lent), lenderCookie)
+	if w.Code != 200 {
+		t.Fatalf("create loan: status %d: %s", w.Code, w.Body)
+	}
+	var created struct {
+		Loan Loan `json:"loan"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	loanID := created.Loan.ID
+	if w := serve(router, http.MethodPost, fmt.Sprintf("/loans/%d/accept", loanID), "", authCookie(t, borrower)); w.Code != 200 {
+		t.Fatalf("accept loan: status %d: %s", w.Code, w.Body)
+	}
+
+	rejected := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"delete", http.MethodDelete, fmt.Sprintf("/collection/%d", lent), ""},
+		{"lend again", http.MethodPost, "/loans", fmt.Sprintf(`{"recipient_id": %d, "volume_ids": [%d]}`, other, lent)},
+		{"move to wishlist", http.MethodPost, fmt.Sprintf("/wishlist/%d", lent), ""},
+		{"move series to wishlist", http.MethodPost, fmt.Sprintf("/wishlist/manga/%d", mangaID), ""},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.path, tt.body, lenderCookie)
+			if w.Code != 409 {
+				t.Errorf("status %d, want 409: %s", w.Code, w.Body)
+			}
+			var status string
+			err := conn.QueryRow(`SELECT status FROM user_manga WHERE user_id = $1 AND manga_volume_id = $2`,
+				lender, lent).Scan(&status)
+			if err != nil || status != "collected" {
+				t.Errorf("lent volume is %q (%v), want collected", status, err)
+			}
+		})
+	}
+
+	if w := serve(router, http.MethodDelete, fmt.Sprintf("/collection/%d", kept), "", lenderCookie); w.Code != 200 {
+		t.Errorf("delete a volume that isn't lent: status %d: %s", w.Code, w.Body)
+	}
+
+	if w := serve(router, http.MethodPost, fmt.Sprintf("/loans/%d/return", loanID), "", lenderCookie); w.Code != 200 {
+		t.Fatalf("return loan: status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(router, http.MethodDelete, fmt.Sprintf("/collection/%d", lent), "", lenderCookie); w.Code != 200 {
+		t.Errorf("delete after return: status %d: %s", w.Code, w.Body)
+	}
+}
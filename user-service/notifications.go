@@ -0,0 +1,415 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+type Notification struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	MangaID   *int            `json:"manga_id"`
+	VolumeID  *int            `json:"volume_id"`
+	Data      json.RawMessage `json:"data"`
+	Read      bool            `json:"read"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type NotificationPreferences struct {
+	NewVolumes            bool   `json:"new_volumes"`
+	UpcomingReleases      bool   `json:"upcoming_releases"`
+	PriceDrops            bool   `json:"price_drops"`
+	LoanReminders         bool   `json:"loan_reminders"`
+	FollowCollectedSeries bool   `json:"follow_collected_series"`
+	UpcomingDays          int    `json:"upcoming_days"`
+	EmailDigest           string `json:"email_digest"` // none, daily or weekly
+}
+
+func defaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{true, true, true, true, true, 7, "none"}
+}
+
+func loadNotificationPreferences(conn *sql.DB, userID int) (NotificationPreferences, error) {
+	p := defaultNotificationPreferences()
+	err := conn.QueryRow(`
+		SELECT new_volumes, upcoming_releases, price_drops, loan_reminders, follow_collected_series,
+		       upcoming_days, email_digest
+		FROM notification_preferences
+		WHERE user_id = $1
+	`, userID).Scan(&p.NewVolumes, &p.UpcomingReleases, &p.PriceDrops, &p.LoanReminders, &p.FollowCollectedSeries,
+		&p.UpcomingDays, &p.EmailDigest)
+	if err == sql.ErrNoRows {
+		return p, nil
+	}
+	return p, err
+}
+
+// getNotifications lists the caller's notifications newest first. Pass
+// unread=true for unread ones only and page with ?before=<id>.
+func getNotifications(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	before, err := strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid before"})
+		return
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`
+		SELECT id, type, manga_id, volume_id, data, read_at IS NOT NULL, created_at
+		FROM notifications
+		WHERE user_id = $1
+		AND ($2 = 0 OR id < $2)
+		AND (NOT $3 OR read_at IS NULL)
+		ORDER BY id DESC
+		LIMIT $4
+	`, userID, before, unreadOnly, limit+1)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.Type, &n.MangaID, &n.VolumeID, &data, &n.Read, &n.CreatedAt); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		n.Data = json.RawMessage(data)
+		notifications = append(notifications, n)
+	}
+
+	hasMore := len(notifications) > limit
+	if hasMore {
+		notifications = notifications[:limit]
+	}
+
+	var unreadCount int
+	err = conn.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&unreadCount)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+
+	c.JSON(200, gin.H{"notifications": notifications, "unread_count": unreadCount, "hasMore": hasMore})
+}
+
+// setNotificationRead serves both POST (mark read) and DELETE (mark unread)
+// on /notifications/:notification_id/read.
+func setNotificationRead(read bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		godotenv.Load()
+		userID, ok := getUserIDFromCookie(c)
+		if !ok {
+			return
+		}
+
+		notificationID, err := strconv.ParseInt(c.Param("notification_id"), 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid notification ID"})
+			return
+		}
+
+		conn, err := get_db_conn()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "DB error"})
+			return
+		}
+		defer conn.Close()
+
+		result, err := conn.Exec(`UPDATE notifications
+			SET read_at = CASE WHEN $3 THEN COALESCE(read_at, NOW()) ELSE NULL END
+			WHERE id = $1 AND user_id = $2`, notificationID, userID, read)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update notification"})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(404, gin.H{"error": "Notification not found"})
+			return
+		}
+		c.JSON(200, gin.H{"success": true})
+	}
+}
+
+func markAllNotificationsRead(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := conn.Exec(`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+	n, _ := result.RowsAffected()
+	c.JSON(200, gin.H{"success": true, "updated": n})
+}
+
+func getNotificationPreferences(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	prefs, err := loadNotificationPreferences(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get notification preferences"})
+		return
+	}
+	c.JSON(200, prefs)
+}
+
+// updateNotificationPreferences accepts any subset of the preferences.
+func updateNotificationPreferences(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	type PreferencesBody struct {
+		NewVolumes            *bool   `json:"new_volumes"`
+		UpcomingReleases      *bool   `json:"upcoming_releases"`
+		PriceDrops            *bool   `json:"price_drops"`
+		LoanReminders         *bool   `json:"loan_reminders"`
+		FollowCollectedSeries *bool   `json:"follow_collected_series"`
+		UpcomingDays          *int    `json:"upcoming_days"`
+		EmailDigest           *string `json:"email_digest"`
+	}
+
+	var body PreferencesBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	if body.UpcomingDays != nil && (*body.UpcomingDays < 1 || *body.UpcomingDays > 60) {
+		c.JSON(400, gin.H{"error": "Upcoming days must be between 1 and 60"})
+		return
+	}
+	if body.EmailDigest != nil && *body.EmailDigest != "none" && *body.EmailDigest != "daily" && *body.EmailDigest != "weekly" {
+		c.JSON(400, gin.H{"error": "Email digest must be none, daily or weekly"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	prefs, err := loadNotificationPreferences(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get notification preferences"})
+		return
+	}
+
+	for _, field := range []struct {
+		value  *bool
+		target *bool
+	}{
+		{body.NewVolumes, &prefs.NewVolumes},
+		{body.UpcomingReleases, &prefs.UpcomingReleases},
+		{body.PriceDrops, &prefs.PriceDrops},
+		{body.LoanReminders, &prefs.LoanReminders},
+		{body.FollowCollectedSeries, &prefs.FollowCollectedSeries},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	if body.UpcomingDays != nil {
+		prefs.UpcomingDays = *body.UpcomingDays
+	}
+	if body.EmailDigest != nil {
+		prefs.EmailDigest = *body.EmailDigest
+	}
+
+	_, err = conn.Exec(`
+		INSERT INTO notification_preferences (user_id, new_volumes, upcoming_releases, price_drops, loan_reminders,
+			follow_collected_series, upcoming_days, email_digest, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			new_volumes = EXCLUDED.new_volumes,
+			upcoming_releases = EXCLUDED.upcoming_releases,
+			price_drops = EXCLUDED.price_drops,
+			loan_reminders = EXCLUDED.loan_reminders,
+			follow_collected_series = EXCLUDED.follow_collected_series,
+			upcoming_days = EXCLUDED.upcoming_days,
+			email_digest = EXCLUDED.email_digest,
+			updated_at = NOW()
+	`, userID, prefs.NewVolumes, prefs.UpcomingReleases, prefs.PriceDrops, prefs.LoanReminders,
+		prefs.FollowCollectedSeries, prefs.UpcomingDays, prefs.EmailDigest)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to save notification preferences"})
+		return
+	}
+	c.JSON(200, prefs)
+}
+
+type FollowedSeries struct {
+	MangaID    int       `json:"manga_id"`
+	MangaTitle *string   `json:"manga_title"`
+	Explicit   bool      `json:"explicit"` // false when followed because the user collects it
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// getFollowedSeries lists the series the caller gets release notifications
+// for, including the ones followed by collecting them.
+func getFollowedSeries(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`
+		WITH followed AS (`+followedSeriesSQL+`)
+		SELECT f.manga_id, COALESCE(m.title_english, m.title_romaji), bool_or(f.explicit), min(f.since)
+		FROM followed f
+		JOIN manga m ON m.id = f.manga_id
+		WHERE f.user_id = $1
+		GROUP BY f.manga_id, m.title_english, m.title_romaji
+		ORDER BY 2
+	`, userID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to get followed series"})
+		return
+	}
+	defer rows.Close()
+
+	series := []FollowedSeries{}
+	for rows.Next() {
+		var s FollowedSeries
+		if err := rows.Scan(&s.MangaID, &s.MangaTitle, &s.Explicit, &s.FollowedAt); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+		series = append(series, s)
+	}
+	c.JSON(200, gin.H{"series": series})
+}
+
+func followSeries(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	mangaID, err := strconv.Atoi(c.Param("manga_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid manga ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRow(`SELECT EXISTS (SELECT 1 FROM manga WHERE id = $1)`, mangaID).Scan(&exists); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to follow series"})
+		return
+	}
+	if !exists {
+		c.JSON(404, gin.H{"error": "Manga not found"})
+		return
+	}
+
+	_, err = conn.Exec(`INSERT INTO series_follows (user_id, manga_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, manga_id) DO NOTHING`, userID, mangaID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to follow series"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
+
+func unfollowSeries(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	mangaID, err := strconv.Atoi(c.Param("manga_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid manga ID"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := conn.Exec(`DELETE FROM series_follows WHERE user_id = $1 AND manga_id = $2`, userID, mangaID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to unfollow series"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "You don't follow this series"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
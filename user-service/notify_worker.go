@@ -0,0 +1,407 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultNotifyIntervalMinutes = 15
+	volumeChangeBatchSize        = 500
+	maxDigestNotifications       = 50
+	// Processed volume_changes rows are kept this long for debugging.
+	volumeChangeRetention = "30 days"
+)
+
+// followedSeriesSQL yields (user_id, manga_id, explicit, since) for every
+// series a user follows, explicitly or by collecting volumes of it.
+const followedSeriesSQL = `
+	SELECT sf.user_id, sf.manga_id, TRUE AS explicit, sf.created_at AS since
+	FROM series_follows sf
+	UNION ALL
+	SELECT um.user_id, v.manga_id, FALSE, MIN(um.added_at)
+	FROM user_manga um
+	JOIN volumes v ON v.id = um.manga_volume_id
+	LEFT JOIN notification_preferences np ON np.user_id = um.user_id
+	WHERE um.status = 'collected' AND COALESCE(np.follow_collected_series, TRUE)
+	GROUP BY um.user_id, v.manga_id`
+
+// runNotificationWorker runs a notification pass every
+// NOTIFY_INTERVAL_MINUTES (15 by default, 0 turns it off). Every step is
+// safe to run from several instances at once.
+func runNotificationWorker() {
+	godotenv.Load()
+	minutes := defaultNotifyIntervalMinutes
+	if raw := os.Getenv("NOTIFY_INTERVAL_MINUTES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			fmt.Println("Invalid NOTIFY_INTERVAL_MINUTES, using the default")
+		} else {
+			minutes = n
+		}
+	}
+	if minutes == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		runNotificationPass()
+		<-ticker.C
+	}
+}
+
+// runNotificationPass turns queued volume changes into notifications, adds
+// upcoming release notifications and sends the email digests that are due.
+func runNotificationPass() {
+	conn, err := get_db_conn()
+	if err != nil {
+		fmt.Println("notifications: DB error:", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := processVolumeChanges(conn); err != nil {
+		fmt.Println("notifications: failed to process volume changes:", err)
+	}
+	if err := queueUpcomingReleases(conn); err != nil {
+		fmt.Println("notifications: failed to queue upcoming releases:", err)
+	}
+	if err := sendNotificationDigests(conn); err != nil {
+		fmt.Println("notifications: failed to send digests:", err)
+	}
+
+	_, err = conn.Exec(`DELETE FROM volume_changes WHERE processed_at < NOW() - $1::interval`, volumeChangeRetention)
+	if err != nil {
+		fmt.Println("notifications: failed to clean up volume changes:", err)
+	}
+}
+
+func processVolumeChanges(conn *sql.DB) (int, error) {
+	total := 0
+	for {
+		n, err := processVolumeChangeBatch(conn)
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+	}
+}
+
+// processVolumeChangeBatch handles up to volumeChangeBatchSize queued
+// changes. New volumes notify the series' followers who don't have the
+// volume yet; price drops notify whoever wishlisted the volume.
+func processVolumeChangeBatch(conn *sql.DB) (int, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.Query(`SELECT id FROM volume_changes WHERE processed_at IS NULL
+		ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, volumeChangeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.Exec(`
+		WITH followed AS (`+followedSeriesSQL+`)
+		INSERT INTO notifications (user_id, type, manga_id, volume_id, data, dedupe_key)
+		SELECT DISTINCT f.user_id, 'new_volume', v.manga_id, v.id,
+		       jsonb_build_object(
+		           'manga_title', COALESCE(m.title_english, m.title_romaji),
+		           'volume_title', v.title,
+		           'volume_number', v.volume_number,
+		           'published_date', v.published_date::date),
+		       'new_volume:' || v.id
+		FROM volume_changes vc
+		JOIN volumes v ON v.id = vc.volume_id
+		JOIN manga m ON m.id = v.manga_id
+		JOIN followed f ON f.manga_id = v.manga_id
+		LEFT JOIN notification_preferences np ON np.user_id = f.user_id
+		WHERE vc.id = ANY($1) AND vc.change = 'inserted'
+		AND COALESCE(np.new_volumes, TRUE)
+		AND NOT EXISTS (SELECT 1 FROM user_manga um WHERE um.user_id = f.user_id AND um.manga_volume_id = v.id)
+		ON CONFLICT (user_id, dedupe_key) DO NOTHING
+	`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	// Only drops within one currency count. under_target is only worked out
+	// when the max price is in that currency too.
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, type, manga_id, volume_id, data, dedupe_key)
+		SELECT um.user_id, 'price_drop', v.manga_id, v.id,
+		       jsonb_build_object(
+		           'manga_title', COALESCE(m.title_english, m.title_romaji),
+		           'volume_title', v.title,
+		           'old_price', vc.old_price_amount,
+		           'new_price', vc.new_price_amount,
+		           'currency', vc.new_price_currency,
+		           'max_price', um.wishlist_max_price,
+		           'under_target', um.wishlist_max_price IS NOT NULL
+		               AND um.wishlist_max_price_currency = vc.new_price_currency
+		               AND vc.new_price_amount <= um.wishlist_max_price),
+		       'price_drop:' || vc.id
+		FROM volume_changes vc
+		JOIN volumes v ON v.id = vc.volume_id
+		JOIN manga m ON m.id = v.manga_id
+		JOIN user_manga um ON um.manga_volume_id = v.id AND um.status = 'wishlisted'
+		LEFT JOIN notification_preferences np ON np.user_id = um.user_id
+		WHERE vc.id = ANY($1) AND vc.change = 'price_changed'
+		AND vc.new_price_amount < vc.old_price_amount
+		AND vc.new_price_currency IS NOT DISTINCT FROM vc.old_price_currency
+		AND COALESCE(np.price_drops, TRUE)
+		ON CONFLICT (user_id, dedupe_key) DO NOTHING
+	`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE volume_changes SET processed_at = NOW() WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	rollback = false
+
+	return len(ids), nil
+}
+
+// queueUpcomingReleases notifies users about volumes coming out within their
+// upcoming_days, for series they follow and volumes they wishlisted. The
+// dedupe key includes the date, so a moved release date notifies again.
+func queueUpcomingReleases(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		WITH followed AS (` + followedSeriesSQL + `),
+		interested AS (
+			SELECT user_id, manga_id, NULL::int AS volume_id FROM followed
+			UNION
+			SELECT um.user_id, v.manga_id, um.manga_volume_id
+			FROM user_manga um
+			JOIN volumes v ON v.id = um.manga_volume_id
+			WHERE um.status = 'wishlisted'
+		)
+		INSERT INTO notifications (user_id, type, manga_id, volume_id, data, dedupe_key)
+		SELECT DISTINCT i.user_id, 'upcoming_release', v.manga_id, v.id,
+		       jsonb_build_object(
+		           'manga_title', COALESCE(m.title_english, m.title_romaji),
+		           'volume_title', v.title,
+		           'volume_number', v.volume_number,
+		           'published_date', v.published_date::date),
+		       'upcoming_release:' || v.id || ':' || v.published_date::date
+		FROM volumes v
+		JOIN manga m ON m.id = v.manga_id
+		JOIN interested i ON i.manga_id = v.manga_id AND (i.volume_id IS NULL OR i.volume_id = v.id)
+		LEFT JOIN notification_preferences np ON np.user_id = i.user_id
+		WHERE v.published_date::date > CURRENT_DATE
+		AND v.published_date::date <= CURRENT_DATE + COALESCE(np.upcoming_days, 7)::int
+		AND COALESCE(np.upcoming_releases, TRUE)
+		AND NOT EXISTS (
+			SELECT 1 FROM user_manga um
+			WHERE um.user_id = i.user_id AND um.manga_volume_id = v.id AND um.status = 'collected'
+		)
+		ON CONFLICT (user_id, dedupe_key) DO NOTHING
+	`)
+	return err
+}
+
+// Fields notifications keep in their data column.
+type notificationData struct {
+	MangaTitle    string   `json:"manga_title"`
+	VolumeTitle   string   `json:"volume_title"`
+	PublishedDate string   `json:"published_date"`
+	OldPrice      *float64 `json:"old_price"`
+	NewPrice      *float64 `json:"new_price"`
+	Currency      string   `json:"currency"`
+	UnderTarget   bool     `json:"under_target"`
+	LoanID        int      `json:"loan_id"`
+	From          string   `json:"from"`
+	DueDate       string   `json:"due_date"`
+}
+
+// describeNotification is the one line summary used in digests.
+func describeNotification(kind string, raw []byte) string {
+	var d notificationData
+	json.Unmarshal(raw, &d)
+
+	switch kind {
+	case "new_volume":
+		return fmt.Sprintf("New volume: %s (%s)", d.VolumeTitle, d.MangaTitle)
+	case "upcoming_release":
+		return fmt.Sprintf("Coming out %s: %s (%s)", d.PublishedDate, d.VolumeTitle, d.MangaTitle)
+	case "price_drop":
+		line := fmt.Sprintf("Price drop: %s", d.VolumeTitle)
+		if d.OldPrice != nil && d.NewPrice != nil {
+			line += fmt.Sprintf(" went from %.2f to %.2f %s", *d.OldPrice, *d.NewPrice, d.Currency)
+		}
+		if d.UnderTarget {
+			line += ", under your target price"
+		}
+		return line
+	case "loan_reminder":
+		line := fmt.Sprintf("%s reminded you about loan #%d", d.From, d.LoanID)
+		if d.DueDate != "" {
+			line += ", due " + d.DueDate
+		}
+		return line
+	}
+	return kind
+}
+
+// sendNotificationDigests emails each user who asked for a digest their
+// unread notifications that haven't been emailed yet. It does nothing when
+// SMTP isn't configured.
+func sendNotificationDigests(conn *sql.DB) error {
+	if os.Getenv("SMTP") == "" {
+		return nil
+	}
+
+	type digestUser struct {
+		userID       int
+		email        string
+		username     string
+		lastDigestAt sql.NullTime
+	}
+
+	rows, err := conn.Query(`
+		SELECT np.user_id, u.email, u.username, np.last_digest_at
+		FROM notification_preferences np
+		JOIN users u ON u.id = np.user_id
+		WHERE np.email_digest <> 'none'
+		AND (np.last_digest_at IS NULL OR np.last_digest_at <
+			NOW() - CASE np.email_digest WHEN 'daily' THEN INTERVAL '1 day' ELSE INTERVAL '7 days' END)
+	`)
+	if err != nil {
+		return err
+	}
+	var due []digestUser
+	for rows.Next() {
+		var u digestUser
+		if err := rows.Scan(&u.userID, &u.email, &u.username, &u.lastDigestAt); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range due {
+		// Claim the digest first so a second worker skips this user.
+		result, err := conn.Exec(`UPDATE notification_preferences SET last_digest_at = NOW()
+			WHERE user_id = $1 AND last_digest_at IS NOT DISTINCT FROM $2`, u.userID, u.lastDigestAt)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		nrows, err := conn.Query(`
+			SELECT id, type, data FROM notifications
+			WHERE user_id = $1 AND read_at IS NULL AND emailed_at IS NULL
+			ORDER BY id DESC
+			LIMIT $2
+		`, u.userID, maxDigestNotifications)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		var lines []string
+		for nrows.Next() {
+			var id int64
+			var kind string
+			var data []byte
+			if err := nrows.Scan(&id, &kind, &data); err != nil {
+				nrows.Close()
+				return err
+			}
+			ids = append(ids, id)
+			lines = append(lines, "- "+describeNotification(kind, data))
+		}
+		nrows.Close()
+		if err := nrows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		body := fmt.Sprintf("Hi %s,\n\nHere is what happened on MangaCollect:\n\n%s\n\nSee everything at %s/notifications\n",
+			u.username, strings.Join(lines, "\n"), os.Getenv("FRONTEND_URL"))
+		if !emailDigest(u.email, body) {
+			continue
+		}
+
+		if _, err := conn.Exec(`UPDATE notifications SET emailed_at = NOW() WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func emailDigest(email string, body string) bool {
+	smtpHost := os.Getenv("SMTP")
+	smtpPort := os.Getenv("SMTP_PORT")
+	smtpUser := os.Getenv("EMAIL")
+	smtpPass := os.Getenv("APP_PASSWORD")
+	from := os.Getenv("EMAIL")
+
+	subject := "Your MangaCollect updates"
+
+	msg := "From: " + from + "\r\n" +
+		"To: " + email + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+		"\r\n" +
+		body
+
+	addr := smtpHost + ":" + smtpPort
+	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
+
+	err := smtp.SendMail(addr, auth, from, []string{email}, []byte(msg))
+	if err != nil {
+		fmt.Println("Failed to send digest email:", err)
+		fmt.Println("Check your SMTP configuration and credentials.")
+		return false
+	}
+	return true
+}
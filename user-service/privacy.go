@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const (
+	visibilityPublic    = "public"
+	visibilityFollowers = "followers"
+	visibilityPrivate   = "private"
+)
+
+type PrivacySettings struct {
+	ProfileVisibility    string `json:"profile_visibility"`
+	CollectionVisibility string `json:"collection_visibility"`
+	WishlistVisibility   string `json:"wishlist_visibility"`
+}
+
+func validVisibility(v string) bool {
+	return v == visibilityPublic || v == visibilityFollowers || v == visibilityPrivate
+}
+
+// loadPrivacySettings returns the user's settings, defaulting to public.
+func loadPrivacySettings(conn *sql.DB, userID int) (PrivacySettings, error) {
+	settings := PrivacySettings{visibilityPublic, visibilityPublic, visibilityPublic}
+	err := conn.QueryRow(`
+		SELECT profile_visibility, collection_visibility, wishlist_visibility
+		FROM user_privacy_settings
+		WHERE user_id = $1
+	`, userID).Scan(&settings.ProfileVisibility, &settings.CollectionVisibility, &settings.WishlistVisibility)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	return settings, err
+}
+
+// followsNeedApproval says whether new followers wait for the user to accept
+// them. Approved followers can see anything followers-only, so only a public
+// profile with nothing followers-only takes them straight away.
+func (s PrivacySettings) followsNeedApproval() bool {
+	return s.ProfileVisibility != visibilityPublic ||
+		s.CollectionVisibility == visibilityFollowers ||
+		s.WishlistVisibility == visibilityFollowers
+}
+
+func isFollowing(conn *sql.DB, followerID int, followeeID int) (bool, error) {
+	var following bool
+	err := conn.QueryRow(`SELECT EXISTS (
+		SELECT 1 FROM user_follows WHERE follower_id = $1 AND followee_id = $2 AND approved
+	)`, followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+// What a viewer may see of someone's profile. Collection and Wishlist are
+// never true when Profile is false.
+type profileAccess struct {
+	Profile    bool
+	Collection bool
+	Wishlist   bool
+}
+
+func (a profileAccess) canSee(status string) bool {
+	switch status {
+	case "collected":
+		return a.Collection
+	case "wishlisted":
+		return a.Wishlist
+	}
+	return false
+}
+
+// statuses lists the user_manga statuses the viewer may see.
+func (a profileAccess) statuses() []string {
+	var statuses []string
+	if a.Collection {
+		statuses = append(statuses, "collected")
+	}
+	if a.Wishlist {
+		statuses = append(statuses, "wishlisted")
+	}
+	return statuses
+}
+
+// resolveProfileAccess applies ownerID's privacy settings to viewerID. The
+// owner always sees everything.
+func resolveProfileAccess(conn *sql.DB, viewerID int, ownerID int) (profileAccess, error) {
+	if viewerID == ownerID {
+		return profileAccess{true, true, true}, nil
+	}
+
+	settings, err := loadPrivacySettings(conn, ownerID)
+	if err != nil {
+		return profileAccess{}, err
+	}
+
+	following := false
+	if settings.ProfileVisibility == visibilityFollowers ||
+		settings.CollectionVisibility == visibilityFollowers ||
+		settings.WishlistVisibility == visibilityFollowers {
+		following, err = isFollowing(conn, viewerID, ownerID)
+		if err != nil {
+			return profileAccess{}, err
+		}
+	}
+
+	allowed := func(v string) bool {
+		return v == visibilityPublic || (v == visibilityFollowers && following)
+	}
+
+	var access profileAccess
+	access.Profile = allowed(settings.ProfileVisibility)
+	access.Collection = access.Profile && allowed(settings.CollectionVisibility)
+	access.Wishlist = access.Profile && allowed(settings.WishlistVisibility)
+	return access, nil
+}
+
+// visibilityCondition is the SQL form of the same rule, for queries that
+// list many users at once (search, feeds). column is a visibility column
+// from a LEFT JOINed user_privacy_settings, ownerCol the owner's user id
+// and viewerParam the placeholder bound to the viewer's id.
+func visibilityCondition(column string, ownerCol string, viewerParam string) string {
+	return fmt.Sprintf(`(COALESCE(%[1]s, 'public') = 'public'
+		OR %[2]s = %[3]s
+		OR (%[1]s = 'followers' AND EXISTS (
+			SELECT 1 FROM user_follows vf WHERE vf.follower_id = %[3]s AND vf.followee_id = %[2]s AND vf.approved)))`,
+		column, ownerCol, viewerParam)
+}
+
+func getPrivacySettings(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	settings, err := loadPrivacySettings(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get privacy settings"})
+		return
+	}
+	c.JSON(200, settings)
+}
+
+// updatePrivacySettings accepts any subset of the three settings.
+func updatePrivacySettings(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	type PrivacyBody struct {
+		ProfileVisibility    *string `json:"profile_visibility"`
+		CollectionVisibility *string `json:"collection_visibility"`
+		WishlistVisibility   *string `json:"wishlist_visibility"`
+	}
+
+	var body PrivacyBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	settings, err := loadPrivacySettings(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get privacy settings"})
+		return
+	}
+
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{body.ProfileVisibility, &settings.ProfileVisibility},
+		{body.CollectionVisibility, &settings.CollectionVisibility},
+		{body.WishlistVisibility, &settings.WishlistVisibility},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if !validVisibility(*field.value) {
+			c.JSON(400, gin.H{"error": "Visibility must be public, followers or private"})
+			return
+		}
+		*field.target = *field.value
+	}
+
+	_, err = conn.Exec(`
+		INSERT INTO user_privacy_settings (user_id, profile_visibility, collection_visibility, wishlist_visibility, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			profile_visibility = EXCLUDED.profile_visibility,
+			collection_visibility = EXCLUDED.collection_visibility,
+			wishlist_visibility = EXCLUDED.wishlist_visibility,
+			updated_at = NOW()
+	`, userID, settings.ProfileVisibility, settings.CollectionVisibility, settings.WishlistVisibility)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to save privacy settings"})
+		return
+	}
+
+	// Nothing left to approve once followers get nothing extra.
+	if !settings.followsNeedApproval() {
+		_, err = conn.Exec(`UPDATE user_follows SET approved = TRUE WHERE followee_id = $1 AND NOT approved`, userID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to approve pending follows"})
+			return
+		}
+	}
+	c.JSON(200, settings)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const maxScanBatch = 200
+
+type ScanResult struct {
+	Code     string `json:"code"`
+	ISBN13   string `json:"isbn_13,omitempty"`
+	ISBN10   string `json:"isbn_10,omitempty"`
+	Result   string `json:"result"` // added, invalid, not_found, ambiguous, draft_created, error
+	VolumeID int    `json:"volume_id,omitempty"`
+	MangaID  int    `json:"manga_id,omitempty"`
+	Title    string `json:"title,omitempty"`
+	DraftID  int    `json:"draft_id,omitempty"`
+	BatchID  string `json:"batch_id,omitempty"`
+}
+
+// scanCode resolves one scanned barcode and, when it names exactly one
+// volume, adds it to the user's collection or wishlist. Unknown ISBNs are
+// saved as submission drafts when createDraft is set.
+func scanCode(conn *sql.DB, userID int, code string, status string, createDraft bool) (ScanResult, error) {
+	result := ScanResult{Code: code}
+
+	isbn13, isbn10, err := normalizeISBN(code)
+	if err != nil {
+		result.Result = "invalid"
+		return result, nil
+	}
+	result.ISBN13, result.ISBN10 = isbn13, isbn10
+
+	rows, err := conn.Query(`
+		SELECT v.id, v.manga_id, v.title
+		FROM volumes v
+		WHERE v.isbn_13 = $1 OR v.isbn_10 = NULLIF($2, '')
+	`, isbn13, isbn10)
+	if err != nil {
+		return result, err
+	}
+
+	var matches []ScanResult
+	for rows.Next() {
+		var m ScanResult
+		if err := rows.Scan(&m.VolumeID, &m.MangaID, &m.Title); err != nil {
+			rows.Close()
+			return result, err
+		}
+		matches = append(matches, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	if len(matches) > 1 {
+		result.Result = "ambiguous"
+		return result, nil
+	}
+	if len(matches) == 0 {
+		if !createDraft {
+			result.Result = "not_found"
+			return result, nil
+		}
+		err = conn.QueryRow(`INSERT INTO submission_drafts (user_id, isbn_13, isbn_10, intended_status)
+			VALUES ($1, $2, NULLIF($3, ''), $4)
+			ON CONFLICT (user_id, isbn_13) DO UPDATE SET intended_status = EXCLUDED.intended_status
+			RETURNING id`, userID, isbn13, isbn10, status).Scan(&result.DraftID)
+		if err != nil {
+			return result, err
+		}
+		result.Result = "draft_created"
+		return result, nil
+	}
+
+	result.VolumeID, result.MangaID, result.Title = matches[0].VolumeID, matches[0].MangaID, matches[0].Title
+
+	// Scanning a volume that is already in the same list keeps its added_at.
+	result.BatchID, err = applyCollectionChange(conn, userID, "scan", []int{result.VolumeID}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET
+				status = EXCLUDED.status,
+				added_at = CASE WHEN user_manga.status = EXCLUDED.status
+					THEN user_manga.added_at ELSE EXCLUDED.added_at END`,
+			userID, result.VolumeID, status)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Result = "added"
+	return result, nil
+}
+
+func validScanStatus(status string) bool {
+	return status == "collected" || status == "wishlisted"
+}
+
+func scanISBN(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	type ScanBody struct {
+		Code        string `json:"code"`
+		Status      string `json:"status"`
+		CreateDraft bool   `json:"create_draft"`
+	}
+
+	var body ScanBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	if body.Status == "" {
+		body.Status = "collected"
+	}
+	if !validScanStatus(body.Status) {
+		c.JSON(400, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := scanCode(conn, userID, body.Code, body.Status, body.CreateDraft)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to process scan"})
+		return
+	}
+
+	switch result.Result {
+	case "invalid":
+		c.JSON(400, result)
+	case "not_found":
+		c.JSON(404, result)
+	case "ambiguous":
+		c.JSON(409, result)
+	default:
+		c.JSON(200, result)
+	}
+}
+
+// scanISBNBatch processes every code independently and always answers 200
+// with one result per code, in the order they were sent.
+func scanISBNBatch(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	type ScanBatchBody struct {
+		Codes        []string `json:"codes"`
+		Status       string   `json:"status"`
+		CreateDrafts bool     `json:"create_drafts"`
+	}
+
+	var body ScanBatchBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	if body.Status == "" {
+		body.Status = "collected"
+	}
+	if !validScanStatus(body.Status) {
+		c.JSON(400, gin.H{"error": "Invalid status"})
+		return
+	}
+	if len(body.Codes) == 0 || len(body.Codes) > maxScanBatch {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Send between 1 and %d codes", maxScanBatch)})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	results := make([]ScanResult, 0, len(body.Codes))
+	for _, code := range body.Codes {
+		result, err := scanCode(conn, userID, code, body.Status, body.CreateDrafts)
+		if err != nil {
+			fmt.Println(err)
+			result.Result = "error"
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(200, gin.H{"results": results})
+}
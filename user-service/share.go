@@ -0,0 +1,425 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const maxShareExpiryDays = 365
+
+var errShareNotFound = errors.New("share link not found")
+
+type WishlistShare struct {
+	Token     string     `json:"token"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// A wishlist volume as a share link visitor sees it. The owner's max price
+// and note are left out.
+type SharedWishlistItem struct {
+	WishlistItem
+	Claimed     bool    `json:"claimed"`
+	ClaimedBy   *string `json:"claimed_by,omitempty"`
+	ClaimedByMe bool    `json:"claimed_by_me"`
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func loadWishlistShare(conn *sql.DB, userID int) (*WishlistShare, error) {
+	var s WishlistShare
+	err := conn.QueryRow(`
+		SELECT token, revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()),
+		       created_at, expires_at, revoked_at
+		FROM wishlist_shares
+		WHERE user_id = $1
+	`, userID).Scan(&s.Token, &s.Active, &s.CreatedAt, &s.ExpiresAt, &s.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// resolveShareToken returns the owner of a live share link.
+func resolveShareToken(conn *sql.DB, token string) (int, string, error) {
+	var ownerID int
+	var username string
+	err := conn.QueryRow(`
+		SELECT s.user_id, u.username
+		FROM wishlist_shares s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token = $1 AND s.revoked_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > NOW())
+	`, token).Scan(&ownerID, &username)
+	if err == sql.ErrNoRows {
+		return 0, "", errShareNotFound
+	}
+	return ownerID, username, err
+}
+
+func getWishlistShare(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	share, err := loadWishlistShare(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get share link"})
+		return
+	}
+	if share == nil {
+		c.JSON(404, gin.H{"error": "Your wishlist isn't shared"})
+		return
+	}
+	c.JSON(200, share)
+}
+
+// shareWishlist publishes the caller's wishlist under a fresh token. Calling
+// it again rotates the token, so old links stop working. Claims survive a
+// rotation.
+func shareWishlist(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	type ShareBody struct {
+		ExpiresInDays *int `json:"expires_in_days"`
+	}
+
+	var body ShareBody
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if body.ExpiresInDays != nil {
+		if *body.ExpiresInDays < 1 || *body.ExpiresInDays > maxShareExpiryDays {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Links can expire after 1 to %d days", maxShareExpiryDays)})
+			return
+		}
+		t := time.Now().AddDate(0, 0, *body.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create share link"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(`
+		INSERT INTO wishlist_shares (user_id, token, created_at, expires_at)
+		VALUES ($1, $2, NOW(), $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			token = EXCLUDED.token,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at,
+			revoked_at = NULL
+	`, userID, token, expiresAt)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to create share link"})
+		return
+	}
+
+	share, err := loadWishlistShare(conn, userID)
+	if err != nil || share == nil {
+		c.JSON(500, gin.H{"error": "Failed to get share link"})
+		return
+	}
+	c.JSON(200, share)
+}
+
+func revokeWishlistShare(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	result, err := conn.Exec(`UPDATE wishlist_shares SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to revoke share link"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "Your wishlist isn't shared"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
+
+// getSharedWishlist is the public view of a share link and needs no login.
+// The link overrides the owner's wishlist visibility, since they chose to
+// publish it. Claims are hidden when the owner opens their own link, and a
+// claim only counts if it was made after the volume was (re)wishlisted.
+func getSharedWishlist(c *gin.Context) {
+	godotenv.Load()
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	ownerID, username, err := resolveShareToken(conn, c.Param("token"))
+	if errors.Is(err, errShareNotFound) {
+		c.JSON(404, gin.H{"error": "This link doesn't exist or has expired"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get wishlist"})
+		return
+	}
+
+	wishlist, err := loadWishlist(conn, ownerID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get wishlist"})
+		return
+	}
+
+	viewerID, _ := userIDFromCookie(c)
+	isOwner := viewerID == ownerID
+	items := make([]SharedWishlistItem, 0, len(wishlist))
+	for _, w := range wishlist {
+		w.MaxPrice, w.MaxPriceCurrency, w.Note, w.UnderTarget = nil, nil, nil, false
+		items = append(items, SharedWishlistItem{WishlistItem: w})
+	}
+
+	if !isOwner {
+		rows, err := conn.Query(`
+			SELECT gc.manga_volume_id, gc.claimer_name, gc.claim_token = $2
+			FROM gift_claims gc
+			JOIN user_manga um ON um.user_id = gc.owner_id AND um.manga_volume_id = gc.manga_volume_id
+			WHERE gc.owner_id = $1 AND um.status = 'wishlisted' AND gc.created_at >= um.added_at
+		`, ownerID, c.GetHeader("X-Claim-Token"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to get claims"})
+			return
+		}
+		defer rows.Close()
+
+		claims := make(map[int]SharedWishlistItem)
+		for rows.Next() {
+			var volumeID int
+			var claim SharedWishlistItem
+			if err := rows.Scan(&volumeID, &claim.ClaimedBy, &claim.ClaimedByMe); err != nil {
+				c.JSON(500, gin.H{"error": "Failed to scan row"})
+				return
+			}
+			claims[volumeID] = claim
+		}
+		for i := range items {
+			if claim, ok := claims[items[i].ID]; ok {
+				items[i].Claimed = true
+				items[i].ClaimedBy = claim.ClaimedBy
+				items[i].ClaimedByMe = claim.ClaimedByMe
+			}
+		}
+	}
+
+	c.JSON(200, gin.H{"username": username, "isOwner": isOwner, "volumes": items})
+}
+
+// claimSharedWishlistVolume lets a visitor mark a volume as one they'll
+// gift. The returned claim_token is needed to withdraw the claim, and can be
+// sent back as X-Claim-Token to see which claims are yours.
+func claimSharedWishlistVolume(c *gin.Context) {
+	godotenv.Load()
+
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
+
+	type ClaimBody struct {
+		Name string `json:"name"`
+	}
+
+	var body ClaimBody
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if len(body.Name) > 100 {
+		c.JSON(400, gin.H{"error": "Name is too long"})
+		return
+	}
+	var name *string
+	if body.Name != "" {
+		name = &body.Name
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	ownerID, _, err := resolveShareToken(conn, c.Param("token"))
+	if errors.Is(err, errShareNotFound) {
+		c.JSON(404, gin.H{"error": "This link doesn't exist or has expired"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to claim volume"})
+		return
+	}
+	if viewerID, _ := userIDFromCookie(c); viewerID == ownerID {
+		c.JSON(403, gin.H{"error": "You can't claim gifts on your own wishlist"})
+		return
+	}
+
+	claimToken, err := newShareToken()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to claim volume"})
+		return
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to begin transaction"})
+		return
+	}
+	rollback := true
+	defer func() {
+		if rollback {
+			tx.Rollback()
+		}
+	}()
+
+	var addedAt time.Time
+	err = tx.QueryRow(`SELECT added_at FROM user_manga
+		WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'wishlisted'
+		FOR UPDATE`, ownerID, volumeID).Scan(&addedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "This volume isn't on the wishlist"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to claim volume"})
+		return
+	}
+
+	// Claims from before the volume was last wishlisted no longer count.
+	_, err = tx.Exec(`DELETE FROM gift_claims WHERE owner_id = $1 AND manga_volume_id = $2 AND created_at < $3`,
+		ownerID, volumeID, addedAt)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to claim volume"})
+		return
+	}
+
+	result, err := tx.Exec(`INSERT INTO gift_claims (owner_id, manga_volume_id, claim_token, claimer_name)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (owner_id, manga_volume_id) DO NOTHING`, ownerID, volumeID, claimToken, name)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to claim volume"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(409, gin.H{"error": "Someone already claimed this volume"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	rollback = false
+
+	c.JSON(200, gin.H{"success": true, "claim_token": claimToken})
+}
+
+// unclaimSharedWishlistVolume withdraws a claim. It needs the claim_token
+// handed out when the claim was made, in the X-Claim-Token header.
+func unclaimSharedWishlistVolume(c *gin.Context) {
+	godotenv.Load()
+
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
+	claimToken := c.GetHeader("X-Claim-Token")
+	if claimToken == "" {
+		c.JSON(400, gin.H{"error": "Missing claim token"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	ownerID, _, err := resolveShareToken(conn, c.Param("token"))
+	if errors.Is(err, errShareNotFound) {
+		c.JSON(404, gin.H{"error": "This link doesn't exist or has expired"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to withdraw claim"})
+		return
+	}
+
+	result, err := conn.Exec(`DELETE FROM gift_claims
+		WHERE owner_id = $1 AND manga_volume_id = $2 AND claim_token = $3`, ownerID, volumeID, claimToken)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to withdraw claim"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "Claim not found"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true})
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+// Rates from the exchange_rates table, keyed by ISO currency code.
+// Every amount is converted into base before being summed.
+type exchangeRates struct {
+	base  string
+	rates map[string]float64
+}
+
+func loadExchangeRates(conn *sql.DB) (exchangeRates, error) {
+	base := strings.ToUpper(strings.TrimSpace(os.Getenv("BASE_CURRENCY")))
+	if base == "" {
+		base = "USD"
+	}
+
+	rates := exchangeRates{base: base, rates: map[string]float64{base: 1}}
+
+	rows, err := conn.Query(`SELECT currency, rate_to_base FROM exchange_rates`)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency string
+		var rate float64
+		if err := rows.Scan(&currency, &rate); err == nil {
+			rates.rates[strings.ToUpper(strings.TrimSpace(currency))] = rate
+		}
+	}
+	rates.rates[base] = 1
+
+	return rates, rows.Err()
+}
+
+// convert returns amount in the base currency. A missing currency is treated
+// as the base currency; ok is false when no rate is configured for it.
+func (r exchangeRates) convert(amount float64, currency string) (float64, bool) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = r.base
+	}
+	rate, ok := r.rates[currency]
+	if !ok {
+		return 0, false
+	}
+	return amount * rate, true
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+type StatsBucket struct {
+	Key         string  `json:"key"`
+	Label       string  `json:"label"`
+	Volumes     int     `json:"volumes"`
+	RetailValue float64 `json:"retail_value"`
+	Spent       float64 `json:"spent"`
+}
+
+type CollectionStats struct {
+	Currency   string `json:"currency"`
+	Collection struct {
+		Volumes       int     `json:"volumes"`
+		PricedVolumes int     `json:"priced_volumes"`
+		RetailValue   float64 `json:"retail_value"`
+	} `json:"collection"`
+	Spent struct {
+		Volumes int     `json:"volumes"`
+		Amount  float64 `json:"amount"`
+	} `json:"spent"`
+	Wishlist struct {
+		Volumes        int     `json:"volumes"`
+		PricedVolumes  int     `json:"priced_volumes"`
+		CostToComplete float64 `json:"cost_to_complete"`
+	} `json:"wishlist"`
+	ByPublisher           []StatsBucket `json:"by_publisher"`
+	BySeries              []StatsBucket `json:"by_series"`
+	ByMonth               []StatsBucket `json:"by_month"`
+	UnconvertedCurrencies []string      `json:"unconverted_currencies"`
+}
+
+// Breakdowns only cover collected volumes; wishlisted ones feed cost_to_complete.
+func getCollectionStats(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	rates, err := loadExchangeRates(conn)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load exchange rates"})
+		return
+	}
+
+	rows, err := conn.Query(`
+		SELECT um.status, um.added_at, um.purchase_price, um.purchase_currency,
+		       v.price_amount, v.price_currency, v.publisher,
+		       m.id, COALESCE(m.title_english, m.title_romaji, '')
+		FROM user_manga um
+		JOIN volumes v ON v.id = um.manga_volume_id
+		JOIN manga m ON m.id = v.manga_id
+		WHERE um.user_id = $1
+	`, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get stats"})
+		return
+	}
+	defer rows.Close()
+
+	var stats CollectionStats
+	stats.Currency = rates.base
+
+	byPublisher := make(map[string]*StatsBucket)
+	bySeries := make(map[string]*StatsBucket)
+	byMonth := make(map[string]*StatsBucket)
+	unconverted := make(map[string]bool)
+
+	bucket := func(buckets map[string]*StatsBucket, key string, label string) *StatsBucket {
+		b, ok := buckets[key]
+		if !ok {
+			b = &StatsBucket{Key: key, Label: label}
+			buckets[key] = b
+		}
+		return b
+	}
+
+	for rows.Next() {
+		var status string
+		var addedAt time.Time
+		var purchasePrice, priceAmount sql.NullFloat64
+		var purchaseCurrency, priceCurrency, publisher sql.NullString
+		var mangaID int
+		var mangaTitle string
+
+		err := rows.Scan(&status, &addedAt, &purchasePrice, &purchaseCurrency,
+			&priceAmount, &priceCurrency, &publisher, &mangaID, &mangaTitle)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to scan row"})
+			return
+		}
+
+		var retail float64
+		hasRetail := false
+		if priceAmount.Valid {
+			if converted, ok := rates.convert(priceAmount.Float64, priceCurrency.String); ok {
+				retail, hasRetail = converted, true
+			} else {
+				unconverted[strings.ToUpper(priceCurrency.String)] = true
+			}
+		}
+
+		if status == "wishlisted" {
+			stats.Wishlist.Volumes++
+			if hasRetail {
+				stats.Wishlist.PricedVolumes++
+				stats.Wishlist.CostToComplete += retail
+			}
+			continue
+		}
+		if status != "collected" {
+			continue
+		}
+
+		var spent float64
+		hasSpent := false
+		if purchasePrice.Valid {
+			if converted, ok := rates.convert(purchasePrice.Float64, purchaseCurrency.String); ok {
+				spent, hasSpent = converted, true
+			} else {
+				unconverted[strings.ToUpper(purchaseCurrency.String)] = true
+			}
+		}
+
+		stats.Collection.Volumes++
+		if hasRetail {
+			stats.Collection.PricedVolumes++
+			stats.Collection.RetailValue += retail
+		}
+		if hasSpent {
+			stats.Spent.Volumes++
+			stats.Spent.Amount += spent
+		}
+
+		publisherName := "Unknown"
+		if publisher.Valid && strings.TrimSpace(publisher.String) != "" {
+			publisherName = publisher.String
+		}
+		month := addedAt.Format("2006-01")
+
+		for _, b := range []*StatsBucket{
+			bucket(byPublisher, publisherName, publisherName),
+			bucket(bySeries, strconv.Itoa(mangaID), mangaTitle),
+			bucket(byMonth, month, month),
+		} {
+			b.Volumes++
+			b.RetailValue += retail
+			b.Spent += spent
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get stats"})
+		return
+	}
+
+	stats.Collection.RetailValue = roundMoney(stats.Collection.RetailValue)
+	stats.Spent.Amount = roundMoney(stats.Spent.Amount)
+	stats.Wishlist.CostToComplete = roundMoney(stats.Wishlist.CostToComplete)
+
+	stats.ByPublisher = sortedBuckets(byPublisher, false)
+	stats.BySeries = sortedBuckets(bySeries, false)
+	stats.ByMonth = sortedBuckets(byMonth, true)
+
+	stats.UnconvertedCurrencies = []string{}
+	for currency := range unconverted {
+		stats.UnconvertedCurrencies = append(stats.UnconvertedCurrencies, currency)
+	}
+	sort.Strings(stats.UnconvertedCurrencies)
+
+	c.JSON(200, stats)
+}
+
+// sortedBuckets orders by key when chronological is set (months), otherwise by
+// volume count so the biggest publishers and series come first.
+func sortedBuckets(buckets map[string]*StatsBucket, chronological bool) []StatsBucket {
+	result := make([]StatsBucket, 0, len(buckets))
+	for _, b := range buckets {
+		b.RetailValue = roundMoney(b.RetailValue)
+		b.Spent = roundMoney(b.Spent)
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if chronological || result[i].Volumes == result[j].Volumes {
+			return result[i].Key < result[j].Key
+		}
+		return result[i].Volumes > result[j].Volumes
+	})
+	return result
+}
+
+func setPurchasePrice(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
+
+	type PurchaseBody struct {
+		Amount   *float64 `json:"amount"`
+		Currency string   `json:"currency"`
+	}
+
+	var body PurchaseBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	if body.Amount != nil && *body.Amount < 0 {
+		c.JSON(400, gin.H{"error": "Amount must not be negative"})
+		return
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(body.Currency))
+	if currency != "" && len(currency) != 3 {
+		c.JSON(400, gin.H{"error": "Currency must be a 3-letter code"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	// A null amount clears the recorded purchase.
+	var amount sql.NullFloat64
+	var purchaseCurrency sql.NullString
+	if body.Amount != nil {
+		amount = sql.NullFloat64{Float64: *body.Amount, Valid: true}
+		purchaseCurrency = sql.NullString{String: currency, Valid: currency != ""}
+	}
+
+	batchID, err := applyCollectionChange(conn, userID, "set_purchase_price", []int{volumeID}, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE user_manga SET purchase_price = $3, purchase_currency = $4
+			WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'collected'`,
+			userID, volumeID, amount, purchaseCurrency)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "Not found"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to save purchase price"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
+}
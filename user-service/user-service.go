@@ -10,7 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type UserManga struct {
@@ -45,6 +45,8 @@ type Volume struct {
 	ThumbnailS3Key sql.NullString  `json:"thumbnail_s3_key"`
 	CreatedAt      sql.NullTime    `json:"created_at"`
 	UpdatedAt      sql.NullTime    `json:"updated_at"`
+	EditionID      sql.NullInt64   `json:"edition_id"`
+	LentTo         *LentTo         `json:"lent_to,omitempty"` // collection only, while out on loan
 }
 
 type Claims struct {
@@ -56,25 +58,33 @@ type Claims struct {
 
 // Helper to validate user from cookie JWT only
 func getUserIDFromCookie(c *gin.Context) (int, bool) {
+	userID, errMsg := userIDFromCookie(c)
+	if errMsg != "" {
+		c.JSON(401, gin.H{"error": errMsg})
+		return 0, false
+	}
+	return userID, true
+}
+
+// userIDFromCookie is getUserIDFromCookie without the 401, for endpoints that
+// also serve anonymous visitors. errMsg is empty when the cookie is valid.
+func userIDFromCookie(c *gin.Context) (userID int, errMsg string) {
 	godotenv.Load()
 	tokenString, err := c.Cookie("access_token")
 	if err != nil {
-		c.JSON(401, gin.H{"error": "No token"})
-		return 0, false
+		return 0, "No token"
 	}
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
 		return []byte(os.Getenv("SECRET_KEY")), nil
 	})
 	if err != nil || !token.Valid {
-		c.JSON(401, gin.H{"error": "Invalid token"})
-		return 0, false
+		return 0, "Invalid token"
 	}
 	claims, ok := token.Claims.(*Claims)
 	if !ok {
-		c.JSON(401, gin.H{"error": "Invalid token claims"})
-		return 0, false
+		return 0, "Invalid token claims"
 	}
-	return claims.UserID, true
+	return claims.UserID, ""
 }
 
 func addToCollection(c *gin.Context) {
@@ -83,7 +93,11 @@ func addToCollection(c *gin.Context) {
 	if !ok {
 		return
 	}
-	volumeID := c.Param("volume_id")
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
 
 	conn, err := get_db_conn()
 	if err != nil {
@@ -92,15 +106,19 @@ func addToCollection(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(`INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
-		VALUES ($1, $2, 'collected', NOW())
-		ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='collected', added_at=NOW()`,
-		userID, volumeID)
+	batchID, err := applyCollectionChange(conn, userID, "add_to_collection", []int{volumeID}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
+			VALUES ($1, $2, 'collected', NOW())
+			ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='collected',
+				added_at = CASE WHEN user_manga.status = 'collected' THEN user_manga.added_at ELSE NOW() END`,
+			userID, volumeID)
+		return err
+	})
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to add to collection"})
 		return
 	}
-	c.JSON(200, gin.H{"success": true})
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
 }
 
 func getCollectionVolume(c *gin.Context) {
@@ -123,7 +141,7 @@ func getCollectionVolume(c *gin.Context) {
 		SELECT v.id, v.manga_id, v.title, v.subtitle, v.volume_number, v.isbn_13, v.isbn_10, v.page_count,
 		       v.publisher, v.published_date, v.description, v.language, v.categories, v.price_amount,
 		       v.price_currency, v.country, v.preview_link, v.info_link, v.thumbnail_url, v.thumbnail_s3_key,
-		       v.created_at, v.updated_at
+		       v.created_at, v.updated_at, v.edition_id
 		FROM user_manga um
 		JOIN volumes v ON um.manga_volume_id = v.id
 		WHERE um.user_id = $1 AND um.manga_volume_id = $2 AND um.status = 'collected'
@@ -131,12 +149,19 @@ func getCollectionVolume(c *gin.Context) {
 		&v.ID, &v.MangaID, &v.Title, &v.Subtitle, &v.VolumeNumber, &v.ISBN13, &v.ISBN10, &v.PageCount,
 		&v.Publisher, &v.PublishedDate, &v.Description, &v.Language, &v.Categories, &v.PriceAmount,
 		&v.PriceCurrency, &v.Country, &v.PreviewLink, &v.InfoLink, &v.ThumbnailURL, &v.ThumbnailS3Key,
-		&v.CreatedAt, &v.UpdatedAt,
+		&v.CreatedAt, &v.UpdatedAt, &v.EditionID,
 	)
 	if err != nil {
 		c.JSON(404, gin.H{"error": "Not found"})
 		return
 	}
+
+	lent, err := loadLentVolumes(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get loans"})
+		return
+	}
+	v.LentTo = lent[v.ID]
 	c.JSON(200, v)
 }
 
@@ -146,7 +171,11 @@ func deleteCollectionVolume(c *gin.Context) {
 	if !ok {
 		return
 	}
-	volumeID := c.Param("volume_id")
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
 
 	conn, err := get_db_conn()
 	if err != nil {
@@ -155,12 +184,21 @@ func deleteCollectionVolume(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(`DELETE FROM user_manga WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'collected'`, userID, volumeID)
+	batchID, err := applyCollectionChange(conn, userID, "delete_from_collection", []int{volumeID}, func(tx *sql.Tx) error {
+		if err := checkNotLentOut(tx, userID, []int{volumeID}); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM user_manga WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'collected'`, userID, volumeID)
+		return err
+	})
+	if respondLentOut(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to delete"})
 		return
 	}
-	c.JSON(200, gin.H{"success": true})
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
 }
 
 func getAllCollection(c *gin.Context) {
@@ -181,7 +219,7 @@ func getAllCollection(c *gin.Context) {
 		SELECT v.id, v.manga_id, v.title, v.subtitle, v.volume_number, v.isbn_13, v.isbn_10, v.page_count,
 		       v.publisher, v.published_date, v.description, v.language, v.categories, v.price_amount,
 		       v.price_currency, v.country, v.preview_link, v.info_link, v.thumbnail_url, v.thumbnail_s3_key,
-		       v.created_at, v.updated_at
+		       v.created_at, v.updated_at, v.edition_id
 		FROM user_manga um
 		JOIN volumes v ON um.manga_volume_id = v.id
 		WHERE um.user_id = $1 AND um.status = 'collected'
@@ -202,7 +240,7 @@ func getAllCollection(c *gin.Context) {
 			&v.ID, &v.MangaID, &v.Title, &v.Subtitle, &v.VolumeNumber, &v.ISBN13, &v.ISBN10, &v.PageCount,
 			&v.Publisher, &v.PublishedDate, &v.Description, &v.Language, &v.Categories, &v.PriceAmount,
 			&v.PriceCurrency, &v.Country, &v.PreviewLink, &v.InfoLink, &v.ThumbnailURL, &v.ThumbnailS3Key,
-			&v.CreatedAt, &v.UpdatedAt,
+			&v.CreatedAt, &v.UpdatedAt, &v.EditionID,
 		)
 		fmt.Println(v)
 		if err == nil {
@@ -212,6 +250,15 @@ func getAllCollection(c *gin.Context) {
 		}
 	}
 
+	lent, err := loadLentVolumes(conn, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get loans"})
+		return
+	}
+	for i := range result {
+		result[i].LentTo = lent[result[i].ID]
+	}
+
 	fmt.Println(result)
 	c.JSON(200, result)
 }
@@ -222,7 +269,11 @@ func addToWishlist(c *gin.Context) {
 	if !ok {
 		return
 	}
-	volumeID := c.Param("volume_id")
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
 
 	conn, err := get_db_conn()
 	if err != nil {
@@ -232,16 +283,26 @@ func addToWishlist(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(`INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
-		VALUES ($1, $2, 'wishlisted', NOW())
-		ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='wishlisted', added_at=NOW()`,
-		userID, volumeID)
+	batchID, err := applyCollectionChange(conn, userID, "add_to_wishlist", []int{volumeID}, func(tx *sql.Tx) error {
+		if err := checkNotLentOut(tx, userID, []int{volumeID}); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
+			VALUES ($1, $2, 'wishlisted', NOW())
+			ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='wishlisted',
+				added_at = CASE WHEN user_manga.status = 'wishlisted' THEN user_manga.added_at ELSE NOW() END`,
+			userID, volumeID)
+		return err
+	})
+	if respondLentOut(c, err) {
+		return
+	}
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(500, gin.H{"error": "Failed to add to wishlist"})
 		return
 	}
-	c.JSON(200, gin.H{"success": true})
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
 }
 
 func getWishlistVolume(c *gin.Context) {
@@ -264,7 +325,7 @@ func getWishlistVolume(c *gin.Context) {
 		SELECT v.id, v.manga_id, v.title, v.subtitle, v.volume_number, v.isbn_13, v.isbn_10, v.page_count,
 		       v.publisher, v.published_date, v.description, v.language, v.categories, v.price_amount,
 		       v.price_currency, v.country, v.preview_link, v.info_link, v.thumbnail_url, v.thumbnail_s3_key,
-		       v.created_at, v.updated_at
+		       v.created_at, v.updated_at, v.edition_id
 		FROM user_manga um
 		JOIN volumes v ON um.manga_volume_id = v.id
 		WHERE um.user_id = $1 AND um.manga_volume_id = $2 AND um.status = 'wishlisted'
@@ -272,7 +333,7 @@ func getWishlistVolume(c *gin.Context) {
 		&v.ID, &v.MangaID, &v.Title, &v.Subtitle, &v.VolumeNumber, &v.ISBN13, &v.ISBN10, &v.PageCount,
 		&v.Publisher, &v.PublishedDate, &v.Description, &v.Language, &v.Categories, &v.PriceAmount,
 		&v.PriceCurrency, &v.Country, &v.PreviewLink, &v.InfoLink, &v.ThumbnailURL, &v.ThumbnailS3Key,
-		&v.CreatedAt, &v.UpdatedAt,
+		&v.CreatedAt, &v.UpdatedAt, &v.EditionID,
 	)
 	if err != nil {
 		c.JSON(404, gin.H{"error": "Not found"})
@@ -287,7 +348,11 @@ func deleteWishlistVolume(c *gin.Context) {
 	if !ok {
 		return
 	}
-	volumeID := c.Param("volume_id")
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
 
 	conn, err := get_db_conn()
 	if err != nil {
@@ -296,14 +361,20 @@ func deleteWishlistVolume(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(`DELETE FROM user_manga WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'wishlisted'`, userID, volumeID)
+	batchID, err := applyCollectionChange(conn, userID, "delete_from_wishlist", []int{volumeID}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM user_manga WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'wishlisted'`, userID, volumeID)
+		return err
+	})
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to delete"})
 		return
 	}
-	c.JSON(200, gin.H{"success": true})
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
 }
 
+// getAllWishlist lists the wishlist in the user's manual order. sort can be
+// position, priority, price, max_price, added or title, with order=asc|desc,
+// and under_target=true keeps only items listed at or below their max price.
 func getAllWishlist(c *gin.Context) {
 	godotenv.Load()
 	userID, ok := getUserIDFromCookie(c)
@@ -311,6 +382,12 @@ func getAllWishlist(c *gin.Context) {
 		return
 	}
 
+	order := c.DefaultQuery("order", "asc")
+	if order != "asc" && order != "desc" {
+		c.JSON(400, gin.H{"error": "Order must be asc or desc"})
+		return
+	}
+
 	conn, err := get_db_conn()
 	if err != nil {
 		c.JSON(500, gin.H{"error": "DB error"})
@@ -318,33 +395,27 @@ func getAllWishlist(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	rows, err := conn.Query(`
-		SELECT v.id, v.manga_id, v.title, v.subtitle, v.volume_number, v.isbn_13, v.isbn_10, v.page_count,
-		       v.publisher, v.published_date, v.description, v.language, v.categories, v.price_amount,
-		       v.price_currency, v.country, v.preview_link, v.info_link, v.thumbnail_url, v.thumbnail_s3_key,
-		       v.created_at, v.updated_at
-		FROM user_manga um
-		JOIN volumes v ON um.manga_volume_id = v.id
-		WHERE um.user_id = $1 AND um.status = 'wishlisted'
-	`, userID)
+	result, err := loadWishlist(conn, userID)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to get wishlist"})
 		return
 	}
-	defer rows.Close()
 
-	var result []Volume
-	for rows.Next() {
-		var v Volume
-		err := rows.Scan(
-			&v.ID, &v.MangaID, &v.Title, &v.Subtitle, &v.VolumeNumber, &v.ISBN13, &v.ISBN10, &v.PageCount,
-			&v.Publisher, &v.PublishedDate, &v.Description, &v.Language, &v.Categories, &v.PriceAmount,
-			&v.PriceCurrency, &v.Country, &v.PreviewLink, &v.InfoLink, &v.ThumbnailURL, &v.ThumbnailS3Key,
-			&v.CreatedAt, &v.UpdatedAt,
-		)
-		if err == nil {
-			result = append(result, v)
+	if sortKey, found := c.GetQuery("sort"); found {
+		if !sortWishlist(result, sortKey, order == "desc") {
+			c.JSON(400, gin.H{"error": "Invalid sort"})
+			return
+		}
+	}
+
+	if c.Query("under_target") == "true" {
+		under := []WishlistItem{}
+		for _, w := range result {
+			if w.UnderTarget {
+				under = append(under, w)
+			}
 		}
+		result = under
 	}
 	c.JSON(200, result)
 }
@@ -355,7 +426,11 @@ func moveWishlistToCollection(c *gin.Context) {
 	if !ok {
 		return
 	}
-	volumeID := c.Param("volume_id")
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
 
 	conn, err := get_db_conn()
 	if err != nil {
@@ -364,13 +439,16 @@ func moveWishlistToCollection(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(`UPDATE user_manga SET status = 'collected', added_at = NOW()
-		WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'wishlisted'`, userID, volumeID)
+	batchID, err := applyCollectionChange(conn, userID, "move_to_collection", []int{volumeID}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE user_manga SET status = 'collected', added_at = NOW()
+			WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'wishlisted'`, userID, volumeID)
+		return err
+	})
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to move to collection"})
 		return
 	}
-	c.JSON(200, gin.H{"success": true})
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
 }
 
 func moveAllMangaToWishlist(c *gin.Context) {
@@ -379,7 +457,18 @@ func moveAllMangaToWishlist(c *gin.Context) {
 	if !ok {
 		return
 	}
-	mangaID := c.Param("manga_id")
+	mangaID, err := strconv.Atoi(c.Param("manga_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid manga ID"})
+		return
+	}
+	// Without edition_id only the series' default edition moves. The
+	// response names the edition and counts the ones left alone.
+	editionID, err := strconv.Atoi(c.DefaultQuery("edition_id", "0"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid edition ID"})
+		return
+	}
 
 	conn, err := get_db_conn()
 	if err != nil {
@@ -388,18 +477,39 @@ func moveAllMangaToWishlist(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(`
-		INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
-		SELECT $1, v.id, 'wishlisted', NOW()
-		FROM volumes v
-		WHERE v.manga_id = $2
-		ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='wishlisted', added_at=NOW()
-	`, userID, mangaID)
+	edition, found, err := mangaEdition(conn, mangaID, editionID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to move all to wishlist"})
+		return
+	}
+	if !found {
+		c.JSON(404, gin.H{"error": "Edition not found"})
+		return
+	}
+	volumeIDs := edition.VolumeIDs
+
+	batchID, err := applyCollectionChange(conn, userID, "move_all_to_wishlist", volumeIDs, func(tx *sql.Tx) error {
+		if err := checkNotLentOut(tx, userID, volumeIDs); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
+			SELECT $1, v.id, 'wishlisted', NOW()
+			FROM volumes v
+			WHERE v.id = ANY($2)
+			ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='wishlisted',
+				added_at = CASE WHEN user_manga.status = 'wishlisted' THEN user_manga.added_at ELSE NOW() END
+		`, userID, pq.Array(volumeIDs))
+		return err
+	})
+	if respondLentOut(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to move all to wishlist"})
 		return
 	}
-	c.JSON(200, gin.H{"success": true})
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID, "edition_id": edition.ID, "other_editions": edition.Others})
 }
 
 func moveAllMangaToCollection(c *gin.Context) {
@@ -408,7 +518,18 @@ func moveAllMangaToCollection(c *gin.Context) {
 	if !ok {
 		return
 	}
-	mangaID := c.Param("manga_id")
+	mangaID, err := strconv.Atoi(c.Param("manga_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid manga ID"})
+		return
+	}
+	// Without edition_id only the series' default edition moves. The
+	// response names the edition and counts the ones left alone.
+	editionID, err := strconv.Atoi(c.DefaultQuery("edition_id", "0"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid edition ID"})
+		return
+	}
 
 	conn, err := get_db_conn()
 	if err != nil {
@@ -417,18 +538,38 @@ func moveAllMangaToCollection(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec(`
-		INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
-		SELECT $1, v.id, 'collected', NOW()
-		FROM volumes v
-		WHERE v.manga_id = $2
-		ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='collected', added_at=NOW()
-	`, userID, mangaID)
+	edition, found, err := mangaEdition(conn, mangaID, editionID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to move all to collection"})
+		return
+	}
+	if !found {
+		c.JSON(404, gin.H{"error": "Edition not found"})
+		return
+	}
+	volumeIDs := edition.VolumeIDs
+
+	// Lent volumes are already collected; leave their rows alone.
+	batchID, err := applyCollectionChange(conn, userID, "move_all_to_collection", volumeIDs, func(tx *sql.Tx) error {
+		lent, err := lentOutVolumes(tx, userID, volumeIDs)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO user_manga (user_id, manga_volume_id, status, added_at)
+			SELECT $1, v.id, 'collected', NOW()
+			FROM volumes v
+			WHERE v.id = ANY($2) AND v.id <> ALL($3)
+			ON CONFLICT (user_id, manga_volume_id) DO UPDATE SET status='collected',
+				added_at = CASE WHEN user_manga.status = 'collected' THEN user_manga.added_at ELSE NOW() END
+		`, userID, pq.Array(volumeIDs), pq.Array(lent))
+		return err
+	})
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to move all to collection"})
 		return
 	}
-	c.JSON(200, gin.H{"success": true})
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID, "edition_id": edition.ID, "other_editions": edition.Others})
 }
 
 func getUniqueManga(c *gin.Context) {
@@ -580,7 +721,8 @@ func getVolumesByMangaAndType(c *gin.Context) {
 	}
 }
 
-// Searching users, will want to add a check on future "private" column, private users are left alone
+// Searching users. Private profiles are left out, followers-only profiles only
+// show up for their followers.
 func search(c *gin.Context) {
 	godotenv.Load()
 
@@ -592,11 +734,20 @@ func search(c *gin.Context) {
 	search, _ := c.GetQuery("search")
 
 	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
 
-	rows, err := conn.Query(`SELECT id AS user_id, username FROM users
-		WHERE similarity(username, $1) > 0.1
-		AND id != $2
-		ORDER BY similarity(username, $1) DESC`,
+	rows, err := conn.Query(`SELECT u.id AS user_id, u.username, f.follower_id IS NOT NULL, COALESCE(f.approved, FALSE)
+		FROM users u
+		LEFT JOIN user_privacy_settings ps ON ps.user_id = u.id
+		LEFT JOIN user_follows f ON f.followee_id = u.id AND f.follower_id = $2
+		WHERE similarity(u.username, $1) > 0.1
+		AND u.id != $2
+		AND `+visibilityCondition("ps.profile_visibility", "u.id", "$2")+`
+		ORDER BY similarity(u.username, $1) DESC`,
 		search,
 		userID,
 	)
@@ -609,15 +760,18 @@ func search(c *gin.Context) {
 	defer rows.Close()
 
 	type UsersFetch struct {
-		UserID   int    `json:"user_id"`
-		Username string `json:"username"`
+		UserID       int    `json:"user_id"`
+		Username     string `json:"username"`
+		FollowStatus string `json:"follow_status"` // none, requested or following
 	}
 
 	var results []UsersFetch
 
 	for rows.Next() {
 		var su UsersFetch
-		if err := rows.Scan(&su.UserID, &su.Username); err == nil {
+		var follows, approved bool
+		if err := rows.Scan(&su.UserID, &su.Username, &follows, &approved); err == nil {
+			su.FollowStatus = followStatus(follows, approved)
 			results = append(results, su)
 		}
 	}
@@ -686,24 +840,29 @@ func getUserUniqueManga(c *gin.Context) {
 		return
 	}
 
-	var rows *sql.Rows
+	access, err := resolveProfileAccess(conn, userID, requestedUserID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+		return
+	}
+
+	// "all" falls back to whichever of collection and wishlist is visible.
+	statuses := []string{mangaType}
 	if mangaType == "all" {
-		rows, err = conn.Query(`
-			SELECT DISTINCT m.id, m.title_english
-			FROM user_manga um
-			JOIN volumes v ON um.manga_volume_id = v.id
-			JOIN manga m ON m.id = v.manga_id
-			WHERE um.user_id = $1
-		`, requestedUserID)
-	} else {
-		rows, err = conn.Query(`
-			SELECT DISTINCT m.id, m.title_english
-			FROM user_manga um
-			JOIN volumes v ON um.manga_volume_id = v.id
-			JOIN manga m ON m.id = v.manga_id
-			WHERE um.user_id = $1 and um.status = $2
-		`, requestedUserID, mangaType)
+		statuses = access.statuses()
 	}
+	if !access.Profile || len(statuses) == 0 || (mangaType != "all" && !access.canSee(mangaType)) {
+		c.JSON(403, gin.H{"error": "This profile is private", "isOwner": isOwner, "username": username})
+		return
+	}
+
+	rows, err := conn.Query(`
+		SELECT DISTINCT m.id, m.title_english
+		FROM user_manga um
+		JOIN volumes v ON um.manga_volume_id = v.id
+		JOIN manga m ON m.id = v.manga_id
+		WHERE um.user_id = $1 and um.status = ANY($2)
+	`, requestedUserID, pq.Array(statuses))
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to get unique manga"})
 		return
@@ -718,7 +877,13 @@ func getUserUniqueManga(c *gin.Context) {
 			mangaMap[mangaTitle] = mangaID
 		}
 	}
-	c.JSON(200, gin.H{"manga": mangaMap, "isOwner": isOwner, "username": username})
+	achievements, err := loadAchievements(conn, requestedUserID, false)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get achievements"})
+		return
+	}
+
+	c.JSON(200, gin.H{"manga": mangaMap, "isOwner": isOwner, "username": username, "achievements": achievements})
 }
 
 func getUserVolumesByMangaAndType(c *gin.Context) {
@@ -739,6 +904,10 @@ func getUserVolumesByMangaAndType(c *gin.Context) {
 
 	mangaID := c.Param("manga_id")
 	colStatus := c.Param("type")
+	if colStatus != "wishlisted" && colStatus != "collected" && colStatus != "neither" {
+		c.JSON(400, gin.H{"error": "Invalid type"})
+		return
+	}
 
 	// when looking for manga volumes that we DONT have in our collection
 	if colStatus == "neither" {
@@ -755,6 +924,17 @@ func getUserVolumesByMangaAndType(c *gin.Context) {
 			return
 		}
 
+		// The missing volumes give away both lists, so both must be visible.
+		access, err := resolveProfileAccess(conn, userID, requestedUserID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+			return
+		}
+		if !access.Collection || !access.Wishlist {
+			c.JSON(403, gin.H{"error": "This profile is private", "isOwner": isOwner, "username": username})
+			return
+		}
+
 		rows, err := conn.Query(`
 			SELECT v.id as volume_id, v.title as volume_title, v.thumbnail_s3_key
 			FROM volumes v
@@ -802,6 +982,16 @@ func getUserVolumesByMangaAndType(c *gin.Context) {
 			return
 		}
 
+		access, err := resolveProfileAccess(conn, userID, requestedUserID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check privacy settings"})
+			return
+		}
+		if !access.canSee(colStatus) {
+			c.JSON(403, gin.H{"error": "This profile is private", "isOwner": isOwner, "username": username})
+			return
+		}
+
 		rows, err := conn.Query(`
 			SELECT v.id as volume_id, v.title as volume_title, v.thumbnail_s3_key
 			FROM user_manga um
@@ -835,6 +1025,23 @@ func getUserVolumesByMangaAndType(c *gin.Context) {
 }
 
 func main() {
+	// "user-service notify" runs a single notification pass, e.g. from cron.
+	if len(os.Args) > 1 && os.Args[1] == "notify" {
+		godotenv.Load()
+		runNotificationPass()
+		return
+	}
+	// "user-service achievements" awards achievements to existing users once.
+	if len(os.Args) > 1 && os.Args[1] == "achievements" {
+		godotenv.Load()
+		if err := backfillAchievements(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	go runNotificationWorker()
+
 	router := gin.Default()
 
 	// Change routes to not require user_id in path
@@ -842,11 +1049,17 @@ func main() {
 	router.GET("/collection/:volume_id", getCollectionVolume)
 	router.DELETE("/collection/:volume_id", deleteCollectionVolume)
 	router.GET("/collection", getAllCollection)
+	router.PUT("/collection/:volume_id/purchase", setPurchasePrice)
 
 	router.POST("/wishlist/:volume_id", addToWishlist)
 	router.GET("/wishlist/:volume_id", getWishlistVolume)
 	router.DELETE("/wishlist/:volume_id", deleteWishlistVolume)
 	router.GET("/wishlist", getAllWishlist)
+	router.GET("/wishlist/share", getWishlistShare)
+	router.POST("/wishlist/share", shareWishlist)
+	router.DELETE("/wishlist/share", revokeWishlistShare)
+	router.PUT("/wishlist/order", reorderWishlist)
+	router.PUT("/wishlist/:volume_id/details", updateWishlistItem)
 
 	router.PUT("/wishlist/:volume_id/collection", moveWishlistToCollection)
 	router.POST("/wishlist/manga/:manga_id", moveAllMangaToWishlist)
@@ -859,5 +1072,61 @@ func main() {
 	router.GET("/:user_id/collection_type/:type/:manga_id", getUserVolumesByMangaAndType)
 
 	router.GET("/search", search)
+
+	router.GET("/privacy", getPrivacySettings)
+	router.PUT("/privacy", updatePrivacySettings)
+
+	// Public share links, no login needed
+	router.GET("/shared/wishlists/:token", getSharedWishlist)
+	router.POST("/shared/wishlists/:token/claims/:volume_id", claimSharedWishlistVolume)
+	router.DELETE("/shared/wishlists/:token/claims/:volume_id", unclaimSharedWishlistVolume)
+
+	router.POST("/follow/:user_id", followUser)
+	router.DELETE("/follow/:user_id", unfollowUser)
+	router.GET("/follow/requests", getFollowRequests)
+	router.POST("/follow/requests/:user_id/accept", acceptFollowRequest)
+	router.DELETE("/followers/:user_id", removeFollower)
+	router.GET("/:user_id/followers", listFollows("followers"))
+	router.GET("/:user_id/following", listFollows("following"))
+	router.GET("/compare/:user_id/:other_user_id", compareCollections)
+
+	router.POST("/loans", createLoan)
+	router.GET("/loans", getLoans)
+	router.GET("/loans/reminders", getLoanReminders)
+	router.GET("/loans/:loan_id", getLoan)
+	router.POST("/loans/:loan_id/accept", acceptLoan)
+	router.POST("/loans/:loan_id/decline", declineLoan)
+	router.POST("/loans/:loan_id/cancel", cancelLoan)
+	router.POST("/loans/:loan_id/return", returnLoan)
+	router.PUT("/loans/:loan_id/due_date", updateLoanDueDate)
+	router.POST("/loans/:loan_id/remind", remindLoan)
+
+	router.GET("/notifications", getNotifications)
+	router.POST("/notifications/read_all", markAllNotificationsRead)
+	router.POST("/notifications/:notification_id/read", setNotificationRead(true))
+	router.DELETE("/notifications/:notification_id/read", setNotificationRead(false))
+	router.GET("/notifications/preferences", getNotificationPreferences)
+	router.PUT("/notifications/preferences", updateNotificationPreferences)
+	router.GET("/followed_series", getFollowedSeries)
+	router.POST("/followed_series/:manga_id", followSeries)
+	router.DELETE("/followed_series/:manga_id", unfollowSeries)
+
+	router.GET("/feed", getFeed)
+	router.GET("/feed/mutes", getFeedMutes)
+	router.PUT("/feed/mutes/:event_type", muteFeedEventType)
+	router.DELETE("/feed/mutes/:event_type", unmuteFeedEventType)
+
+	router.GET("/achievements", getAchievements)
+	router.GET("/:user_id/achievements", getUserAchievements)
+
+	router.GET("/stats", getCollectionStats)
+	router.POST("/import", importCollection)
+	router.GET("/export", exportCollection)
+	router.POST("/scan", scanISBN)
+	router.POST("/scan/batch", scanISBNBatch)
+
+	router.GET("/history", getCollectionHistory)
+	router.POST("/history/:event_id/undo", undoCollectionEvent)
+	router.POST("/history/batches/:batch_id/undo", undoCollectionBatch)
 	router.Run(":8080")
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+)
+
+// Wishlist priorities, stored as 1 (must have) to 5 (someday).
+var wishlistPriorities = []string{"must_have", "high", "medium", "low", "someday"}
+
+func priorityLevel(name string) (int, bool) {
+	for i, p := range wishlistPriorities {
+		if p == name {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+type WishlistItem struct {
+	Volume
+	AddedAt          time.Time `json:"added_at"`
+	Priority         *string   `json:"priority"`
+	MaxPrice         *float64  `json:"max_price"`
+	MaxPriceCurrency *string   `json:"max_price_currency"`
+	Note             *string   `json:"note"`
+	Position         *int      `json:"position"`
+	// Set when the volume's listed price is at or below max_price.
+	UnderTarget bool `json:"under_target"`
+
+	priorityLevel int
+	basePrice     *float64
+	baseMaxPrice  *float64
+}
+
+// loadWishlist returns the user's wishlisted volumes in their manual order,
+// then newest first. It is shared by the owner's listing and public share
+// links.
+func loadWishlist(conn *sql.DB, userID int) ([]WishlistItem, error) {
+	rates, err := loadExchangeRates(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(`
+		SELECT v.id, v.manga_id, v.title, v.subtitle, v.volume_number, v.isbn_13, v.isbn_10, v.page_count,
+		       v.publisher, v.published_date, v.description, v.language, v.categories, v.price_amount,
+		       v.price_currency, v.country, v.preview_link, v.info_link, v.thumbnail_url, v.thumbnail_s3_key,
+		       v.created_at, v.updated_at, v.edition_id,
+		       um.added_at, um.wishlist_priority, um.wishlist_max_price, um.wishlist_max_price_currency,
+		       um.wishlist_note, um.wishlist_position
+		FROM user_manga um
+		JOIN volumes v ON um.manga_volume_id = v.id
+		WHERE um.user_id = $1 AND um.status = 'wishlisted'
+		ORDER BY um.wishlist_position NULLS LAST, um.added_at DESC, v.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []WishlistItem{}
+	for rows.Next() {
+		var w WishlistItem
+		var priority sql.NullInt64
+		v := &w.Volume
+		err := rows.Scan(
+			&v.ID, &v.MangaID, &v.Title, &v.Subtitle, &v.VolumeNumber, &v.ISBN13, &v.ISBN10, &v.PageCount,
+			&v.Publisher, &v.PublishedDate, &v.Description, &v.Language, &v.Categories, &v.PriceAmount,
+			&v.PriceCurrency, &v.Country, &v.PreviewLink, &v.InfoLink, &v.ThumbnailURL, &v.ThumbnailS3Key,
+			&v.CreatedAt, &v.UpdatedAt, &v.EditionID,
+			&w.AddedAt, &priority, &w.MaxPrice, &w.MaxPriceCurrency, &w.Note, &w.Position,
+		)
+		if err != nil {
+			continue
+		}
+
+		if priority.Valid && priority.Int64 >= 1 && int(priority.Int64) <= len(wishlistPriorities) {
+			w.priorityLevel = int(priority.Int64)
+			name := wishlistPriorities[w.priorityLevel-1]
+			w.Priority = &name
+		}
+		if v.PriceAmount.Valid {
+			if price, ok := rates.convert(v.PriceAmount.Float64, v.PriceCurrency.String); ok {
+				w.basePrice = &price
+			}
+		}
+		if w.MaxPrice != nil {
+			currency := ""
+			if w.MaxPriceCurrency != nil {
+				currency = *w.MaxPriceCurrency
+			}
+			if maxPrice, ok := rates.convert(*w.MaxPrice, currency); ok {
+				w.baseMaxPrice = &maxPrice
+			}
+		}
+		w.UnderTarget = w.basePrice != nil && w.baseMaxPrice != nil && *w.basePrice <= *w.baseMaxPrice
+
+		result = append(result, w)
+	}
+	return result, rows.Err()
+}
+
+// sortWishlist orders items by key, keeping items without a value for it at
+// the end whatever the direction. Prices are compared in the base currency.
+func sortWishlist(items []WishlistItem, key string, desc bool) bool {
+	var value func(w WishlistItem) (float64, bool)
+	switch key {
+	case "position":
+		value = func(w WishlistItem) (float64, bool) {
+			if w.Position == nil {
+				return 0, false
+			}
+			return float64(*w.Position), true
+		}
+	case "priority":
+		value = func(w WishlistItem) (float64, bool) { return float64(w.priorityLevel), w.priorityLevel > 0 }
+	case "price":
+		value = func(w WishlistItem) (float64, bool) {
+			if w.basePrice == nil {
+				return 0, false
+			}
+			return *w.basePrice, true
+		}
+	case "max_price":
+		value = func(w WishlistItem) (float64, bool) {
+			if w.baseMaxPrice == nil {
+				return 0, false
+			}
+			return *w.baseMaxPrice, true
+		}
+	case "added":
+		value = func(w WishlistItem) (float64, bool) { return float64(w.AddedAt.UnixNano()), true }
+	case "title":
+		sort.SliceStable(items, func(i, j int) bool {
+			a, b := strings.ToLower(items[i].Title), strings.ToLower(items[j].Title)
+			if desc {
+				return a > b
+			}
+			return a < b
+		})
+		return true
+	default:
+		return false
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		a, aOK := value(items[i])
+		b, bOK := value(items[j])
+		if aOK != bOK {
+			return aOK
+		}
+		if desc {
+			return a > b
+		}
+		return a < b
+	})
+	return true
+}
+
+// updateWishlistItem replaces the priority, max price and note of a
+// wishlisted volume. Omitted or null fields are cleared.
+func updateWishlistItem(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+	volumeID, err := strconv.Atoi(c.Param("volume_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid volume ID"})
+		return
+	}
+
+	type WishlistItemBody struct {
+		Priority         *string  `json:"priority"`
+		MaxPrice         *float64 `json:"max_price"`
+		MaxPriceCurrency *string  `json:"max_price_currency"`
+		Note             *string  `json:"note"`
+	}
+
+	var body WishlistItemBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+
+	var priority *int
+	if body.Priority != nil {
+		level, ok := priorityLevel(*body.Priority)
+		if !ok {
+			c.JSON(400, gin.H{"error": "Priority must be one of " + strings.Join(wishlistPriorities, ", ")})
+			return
+		}
+		priority = &level
+	}
+
+	var currency *string
+	if body.MaxPrice != nil {
+		if *body.MaxPrice < 0 {
+			c.JSON(400, gin.H{"error": "Max price can't be negative"})
+			return
+		}
+		code := ""
+		if body.MaxPriceCurrency != nil {
+			code = strings.ToUpper(strings.TrimSpace(*body.MaxPriceCurrency))
+		}
+		if code != "" && len(code) != 3 {
+			c.JSON(400, gin.H{"error": "Currency must be a 3 letter code"})
+			return
+		}
+		if code != "" {
+			currency = &code
+		}
+	}
+
+	var note *string
+	if body.Note != nil && strings.TrimSpace(*body.Note) != "" {
+		note = body.Note
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	// A missing currency means the base currency, as in purchase prices.
+	if body.MaxPrice != nil && currency == nil {
+		rates, err := loadExchangeRates(conn)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to load exchange rates"})
+			return
+		}
+		currency = &rates.base
+	}
+
+	found := false
+	batchID, err := applyCollectionChange(conn, userID, "update_wishlist_item", []int{volumeID}, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE user_manga SET
+				wishlist_priority = $3,
+				wishlist_max_price = $4,
+				wishlist_max_price_currency = $5,
+				wishlist_note = $6
+			WHERE user_id = $1 AND manga_volume_id = $2 AND status = 'wishlisted'`,
+			userID, volumeID, priority, body.MaxPrice, currency, note)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		found = n > 0
+		return err
+	})
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to update wishlist item"})
+		return
+	}
+	if !found {
+		c.JSON(404, gin.H{"error": "Not found"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
+}
+
+// reorderWishlist stores a manual order. volume_ids lists wishlisted volumes
+// from first to last; anything left out goes after them, unordered.
+func reorderWishlist(c *gin.Context) {
+	godotenv.Load()
+	userID, ok := getUserIDFromCookie(c)
+	if !ok {
+		return
+	}
+
+	type ReorderBody struct {
+		VolumeIDs []int `json:"volume_ids"`
+	}
+
+	var body ReorderBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request!"})
+		return
+	}
+	if len(uniqueInts(body.VolumeIDs)) != len(body.VolumeIDs) {
+		c.JSON(400, gin.H{"error": "Each volume can only appear once"})
+		return
+	}
+
+	conn, err := get_db_conn()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "DB error"})
+		return
+	}
+	defer conn.Close()
+
+	wishlisted := []int{}
+	err = func() error {
+		rows, err := conn.Query(`SELECT manga_volume_id FROM user_manga WHERE user_id = $1 AND status = 'wishlisted'`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			wishlisted = append(wishlisted, id)
+		}
+		return rows.Err()
+	}()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get wishlist"})
+		return
+	}
+
+	inWishlist := make(map[int]bool, len(wishlisted))
+	for _, id := range wishlisted {
+		inWishlist[id] = true
+	}
+	for _, id := range body.VolumeIDs {
+		if !inWishlist[id] {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Volume %d isn't on your wishlist", id)})
+			return
+		}
+	}
+
+	batchID, err := applyCollectionChange(conn, userID, "reorder_wishlist", wishlisted, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE user_manga um SET wishlist_position = o.position
+			FROM (
+				SELECT id, ordinality::int AS position FROM unnest($2::int[]) WITH ORDINALITY AS t(id, ordinality)
+			) o
+			WHERE um.user_id = $1 AND um.manga_volume_id = o.id AND um.status = 'wishlisted'`,
+			userID, pq.Array(body.VolumeIDs))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE user_manga SET wishlist_position = NULL
+			WHERE user_id = $1 AND status = 'wishlisted' AND wishlist_position IS NOT NULL
+			AND NOT (manga_volume_id = ANY($2))`, userID, pq.Array(body.VolumeIDs))
+		return err
+	})
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(500, gin.H{"error": "Failed to reorder wishlist"})
+		return
+	}
+	c.JSON(200, gin.H{"success": true, "batch_id": batchID})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Wishlist details belong to the wishlist entry: collecting the volume
+// clears them, so wishlisting it again starts empty.
+func TestWishlistDetailsClearedWhenCollected(t *testing.T) {
+	conn := newTestDB(t)
+	router := gin.New()
+	router.POST("/wishlist/:volume_id", addToWishlist)
+	router.PUT("/wishlist/order", reorderWishlist)
+	router.PUT("/wishlist/:volume_id/details", updateWishlistItem)
+	router.PUT("/wishlist/:volume_id/collection", moveWishlistToCollection)
+	router.POST("/collection/:volume_id", addToCollection)
+
+	userID := seedUser(t, conn, "wishlist_details")
+	mangaID := seedManga(t, conn, "Wishlist Details Test")
+	volumeID := seedVolume(t, conn, mangaID, 1)
+	cookie := authCookie(t, userID)
+
+	wishlistWithDetails := func(t *testing.T) {
+		t.Helper()
+		for _, step := range []struct {
+			method string
+			path   string
+			body   string
+		}{
+			{http.MethodPost, fmt.Sprintf("/wishlist/%d", volumeID), ""},
+			{http.MethodPut, fmt.Sprintf("/wishlist/%d/details", volumeID),
+				`{"priority": "must_have", "max_price": 9.99, "max_price_currency": "USD", "note": "hardcover"}`},
+			{http.MethodPut, "/wishlist/order", fmt.Sprintf(`{"volume_ids": [%d]}`, volumeID)},
+		} {
+			if w := serve(router, step.method, step.path, step.body, cookie); w.Code != 200 {
+				t.Fatalf("%s %s: status %d: %s", step.method, step.path, w.Code, w.Body)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"moved from the wishlist", http.MethodPut, fmt.Sprintf("/wishlist/%d/collection", volumeID)},
+		{"added to the collection", http.MethodPost, fmt.Sprintf("/collection/%d", volumeID)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wishlistWithDetails(t)
+			if w := serve(router, tt.method, tt.path, "", cookie); w.Code != 200 {
+				t.Fatalf("collect: status %d: %s", w.Code, w.Body)
+			}
+			if w := serve(router, http.MethodPost, fmt.Sprintf("/wishlist/%d", volumeID), "", cookie); w.Code != 200 {
+				t.Fatalf("wishlist again: status %d: %s", w.Code, w.Body)
+			}
+
+			var priority, position sql.NullInt64
+			var maxPrice sql.NullFloat64
+			var currency, note sql.NullString
+			err := conn.QueryRow(`SELECT wishlist_priority, wishlist_max_price, wishlist_max_price_currency,
+					wishlist_note, wishlist_position
+				FROM user_manga WHERE user_id = $1 AND manga_volume_id = $2`, userID, volumeID).
+				Scan(&priority, &maxPrice, &currency, &note, &position)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if priority.Valid || maxPrice.Valid || currency.Valid || note.Valid || position.Valid {
+				t.Errorf("re-wishlisted volume kept its old details: priority %v, max price %v %v, note %v, position %v",
+					priority, maxPrice, currency, note, position)
+			}
+		})
+	}
+}